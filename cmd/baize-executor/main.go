@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"net/http"
+
 	"github.com/spf13/cobra"
 	"k8s.io/kubernetes/pkg/util/rlimit"
 
+	_ "net/http/pprof"
+
+	"github.com/dashjay/baize/pkg/baize"
 	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/executor"
+	"github.com/dashjay/baize/pkg/runner"
 )
 
 func init() {
@@ -13,21 +21,34 @@ func init() {
 		panic(err)
 	}
 }
-func NewBazelServerCommand() *cobra.Command {
+func NewBazelExecutorCommand() *cobra.Command {
 	cmd := &cobra.Command{}
 	cfgPath := cmd.Flags().String("config", "/config.toml", "config file to use")
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		_, err := config.NewConfigFromFile(*cfgPath)
+		cfg, err := config.NewConfigFromFile(*cfgPath)
 		if err != nil {
 			return err
 		}
-		return nil
+		s, err := baize.New(cfg)
+		if err != nil {
+			return err
+		}
+		if pprofAddr := cfg.GetExecutorConfig().PprofAddr; pprofAddr != "" {
+			go func() {
+				http.ListenAndServe(pprofAddr, nil)
+			}()
+		}
+		if cfg.GetExecutorConfig().SchedulerAddr != "" {
+			return executor.New(cfg.GetExecutorConfig(), s).Run(context.Background())
+		}
+		return s.Run()
 	}
 	return cmd
 }
 
 func main() {
-	err := NewBazelServerCommand().Execute()
+	runner.SandboxInit()
+	err := NewBazelExecutorCommand().Execute()
 	if err != nil {
 		panic(err)
 	}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/dashjay/baize/pkg/baize"
 	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/runner"
 )
 
 func init() {
@@ -18,7 +19,7 @@ func init() {
 		panic(err)
 	}
 }
-func NewBazelExecutorCommand() *cobra.Command {
+func NewBazelServerCommand() *cobra.Command {
 	cmd := &cobra.Command{}
 	cfgPath := cmd.Flags().String("config", "/config.toml", "config file to use")
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
@@ -26,11 +27,11 @@ func NewBazelExecutorCommand() *cobra.Command {
 		if err != nil {
 			return err
 		}
-		s, err := baize.New(cfg)
+		s, err := baize.NewServer(cfg)
 		if err != nil {
 			return err
 		}
-		if pprofAddr := cfg.GetExecutorConfig().PprofAddr; pprofAddr != "" {
+		if pprofAddr := cfg.GetServerConfig().PprofAddr; pprofAddr != "" {
 			go func() {
 				http.ListenAndServe(pprofAddr, nil)
 			}()
@@ -41,7 +42,8 @@ func NewBazelExecutorCommand() *cobra.Command {
 }
 
 func main() {
-	err := NewBazelExecutorCommand().Execute()
+	runner.SandboxInit()
+	err := NewBazelServerCommand().Execute()
 	if err != nil {
 		panic(err)
 	}
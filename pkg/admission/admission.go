@@ -0,0 +1,244 @@
+// Package admission limits actions running at the same time by CPU slots and memory of the executor.
+package admission
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/utils/platform"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// defaultCPUs is the CPU slots taken by an action without cpu platform property
+const defaultCPUs = 1
+
+// byteUnits are suffixes accepted by the mem platform property
+var byteUnits = map[string]int64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// Request is resources taken by an action while it is running
+type Request struct {
+	CPUs        int64
+	MemoryBytes int64
+}
+
+func (r Request) fits(free Request) bool {
+	return r.CPUs <= free.CPUs && r.MemoryBytes <= free.MemoryBytes
+}
+
+// NewRequest returns resources requested by the cpu and mem platform properties,
+// 1 CPU slot and defaultMemoryBytes are requested if they are not set.
+func NewRequest(p *repb.Platform, defaultMemoryBytes int64) (Request, error) {
+	r := Request{CPUs: defaultCPUs, MemoryBytes: defaultMemoryBytes}
+	if value := platform.Get(p, platform.CPU); value != "" {
+		cpus, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || cpus <= 0 {
+			return r, status.InvalidArgumentErrorf("%s %q should be a positive integer", platform.CPU, value)
+		}
+		r.CPUs = cpus
+	}
+	if value := platform.Get(p, platform.Memory); value != "" {
+		memoryBytes, err := parseBytes(value)
+		if err != nil {
+			return r, status.InvalidArgumentErrorf("%s %q should be bytes like 512M or 4G", platform.Memory, value)
+		}
+		r.MemoryBytes = memoryBytes
+	}
+	return r, nil
+}
+
+// parseBytes parses bytes with an optional binary unit such as 512M, 4Gi and 1GB
+func parseBytes(value string) (int64, error) {
+	number := strings.TrimRight(value, "kKmMgGtTiB")
+	unit := strings.ToLower(value[len(number):])
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i")
+	multiple, known := byteUnits[unit]
+	if !known {
+		return 0, status.InvalidArgumentErrorf("unknown unit of %s", value)
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, status.InvalidArgumentErrorf("invalid bytes %s", value)
+	}
+	return n * multiple, nil
+}
+
+// HostCapacity returns cpu_slots and memory_budget_bytes of config,
+// the number of CPUs and total memory of the host are used if they are not set.
+func HostCapacity(cfg *config.ExecutorConfig) Request {
+	c := Request{CPUs: int64(cfg.CPUSlots), MemoryBytes: cfg.MemoryBudgetBytes}
+	if c.CPUs <= 0 {
+		c.CPUs = int64(runtime.NumCPU())
+	}
+	if c.MemoryBytes <= 0 {
+		var info unix.Sysinfo_t
+		if err := unix.Sysinfo(&info); err == nil {
+			c.MemoryBytes = int64(info.Totalram) * int64(info.Unit)
+		} else {
+			logrus.WithError(err).Warn("get memory of host error")
+		}
+	}
+	return c
+}
+
+type waiter struct {
+	request Request
+	// ready is closed when the request is admitted
+	ready chan struct{}
+}
+
+// Controller admits actions while their requests fit in free CPU slots and memory,
+// other actions wait in FIFO order, so large actions are not starved by small ones.
+type Controller struct {
+	mu                 sync.Mutex
+	capacity           Request
+	used               Request
+	defaultMemoryBytes int64
+	waiters            []*waiter
+	// changed is closed and replaced every time resources are released or a waiter leaves
+	changed chan struct{}
+}
+
+func New(capacity Request, defaultMemoryBytes int64) *Controller {
+	return &Controller{
+		capacity:           capacity,
+		defaultMemoryBytes: defaultMemoryBytes,
+		changed:            make(chan struct{}),
+	}
+}
+
+// NewFromConfig returns a Controller with capacity and default memory of actions in config
+func NewFromConfig(cfg *config.ExecutorConfig) *Controller {
+	return New(HostCapacity(cfg), cfg.DefaultActionMemoryBytes)
+}
+
+// Capacity returns all resources of the controller
+func (c *Controller) Capacity() Request {
+	return c.capacity
+}
+
+// Request returns resources requested by an action with platform p
+func (c *Controller) Request(p *repb.Platform) (Request, error) {
+	return NewRequest(p, c.defaultMemoryBytes)
+}
+
+// Acquire blocks until r is admitted or ctx is done, the returned function releases r.
+// Requests exceeding the capacity are rejected with FAILED_PRECONDITION.
+func (c *Controller) Acquire(ctx context.Context, r Request) (func(), error) {
+	if !r.fits(c.capacity) {
+		return nil, status.FailedPreconditionErrorf("request of %d CPUs and %d bytes of memory exceeds capacity of %d CPUs and %d bytes",
+			r.CPUs, r.MemoryBytes, c.capacity.CPUs, c.capacity.MemoryBytes)
+	}
+	c.mu.Lock()
+	if len(c.waiters) == 0 && r.fits(c.freeLocked()) {
+		c.takeLocked(r)
+		c.mu.Unlock()
+		return c.releaser(r), nil
+	}
+	w := &waiter{request: r, ready: make(chan struct{})}
+	c.waiters = append(c.waiters, w)
+	c.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return c.releaser(r), nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		select {
+		case <-w.ready:
+			// admitted meanwhile
+			c.returnLocked(r)
+		default:
+			c.removeLocked(w)
+			// waiters behind w may fit now
+			c.admitLocked()
+			c.notifyLocked()
+		}
+		return nil, status.CanceledErrorf("wait for %d CPUs and %d bytes of memory canceled: %s", r.CPUs, r.MemoryBytes, ctx.Err())
+	}
+}
+
+// WaitAvailable blocks until no action is waiting and a CPU slot is free, so a new action may be admitted at once
+func (c *Controller) WaitAvailable(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		available := len(c.waiters) == 0 && c.used.CPUs < c.capacity.CPUs
+		changed := c.changed
+		c.mu.Unlock()
+		if available {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status.CanceledErrorf("wait for free resources canceled: %s", ctx.Err())
+		}
+	}
+}
+
+func (c *Controller) releaser(r Request) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.returnLocked(r)
+		})
+	}
+}
+
+func (c *Controller) freeLocked() Request {
+	return Request{CPUs: c.capacity.CPUs - c.used.CPUs, MemoryBytes: c.capacity.MemoryBytes - c.used.MemoryBytes}
+}
+
+func (c *Controller) takeLocked(r Request) {
+	c.used.CPUs += r.CPUs
+	c.used.MemoryBytes += r.MemoryBytes
+}
+
+// returnLocked gives r back and admits waiters fitting in free resources
+func (c *Controller) returnLocked(r Request) {
+	c.used.CPUs -= r.CPUs
+	c.used.MemoryBytes -= r.MemoryBytes
+	c.admitLocked()
+	c.notifyLocked()
+}
+
+// notifyLocked wakes up WaitAvailable
+func (c *Controller) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// admitLocked admits waiters in order until the first one not fitting
+func (c *Controller) admitLocked() {
+	for len(c.waiters) > 0 && c.waiters[0].request.fits(c.freeLocked()) {
+		w := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		c.takeLocked(w.request)
+		close(w.ready)
+	}
+}
+
+func (c *Controller) removeLocked(w *waiter) {
+	for i := range c.waiters {
+		if c.waiters[i] == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package admission
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/utils/platform"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+func newPlatform(kvs ...string) *repb.Platform {
+	p := &repb.Platform{}
+	for i := 0; i < len(kvs); i += 2 {
+		p.Properties = append(p.Properties, &repb.Platform_Property{Name: kvs[i], Value: kvs[i+1]})
+	}
+	return p
+}
+
+func TestNewRequest(t *testing.T) {
+	r, err := NewRequest(nil, 1<<20)
+	assert.Nil(t, err)
+	assert.Equal(t, Request{CPUs: 1, MemoryBytes: 1 << 20}, r)
+	r, err = NewRequest(newPlatform(platform.CPU, "4", platform.Memory, "2G"), 1<<20)
+	assert.Nil(t, err)
+	assert.Equal(t, Request{CPUs: 4, MemoryBytes: 2 << 30}, r)
+
+	for value, bytes := range map[string]int64{"1024": 1024, "512M": 512 << 20, "4Gi": 4 << 30, "1GB": 1 << 30, "8k": 8 << 10, "1TiB": 1 << 40} {
+		n, err := parseBytes(value)
+		assert.Nil(t, err, value)
+		assert.Equal(t, bytes, n, value)
+	}
+	for _, p := range []*repb.Platform{
+		newPlatform(platform.CPU, "0"),
+		newPlatform(platform.CPU, "1.5"),
+		newPlatform(platform.Memory, "G"),
+		newPlatform(platform.Memory, "-1G"),
+		newPlatform(platform.Memory, "2X"),
+	} {
+		_, err := NewRequest(p, 0)
+		assert.True(t, status.IsInvalidArgumentError(err), platform.String(p))
+	}
+}
+
+func TestHostCapacity(t *testing.T) {
+	c := HostCapacity(&config.ExecutorConfig{CPUSlots: 3, MemoryBudgetBytes: 1 << 30})
+	assert.Equal(t, Request{CPUs: 3, MemoryBytes: 1 << 30}, c)
+	c = HostCapacity(&config.ExecutorConfig{})
+	assert.True(t, c.CPUs > 0)
+	assert.True(t, c.MemoryBytes > 0)
+}
+
+// acquireAsync returns a channel receiving the error of Acquire, the releaser is sent to released on success
+func acquireAsync(ctx context.Context, c *Controller, r Request, released chan<- func()) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		release, err := c.Acquire(ctx, r)
+		if err == nil {
+			released <- release
+		}
+		done <- err
+	}()
+	return done
+}
+
+func TestAcquire(t *testing.T) {
+	ctx := context.Background()
+	c := New(Request{CPUs: 4, MemoryBytes: 4 << 30}, 0)
+	release1, err := c.Acquire(ctx, Request{CPUs: 2, MemoryBytes: 1 << 30})
+	assert.Nil(t, err)
+	release2, err := c.Acquire(ctx, Request{CPUs: 1, MemoryBytes: 3 << 30})
+	assert.Nil(t, err)
+
+	_, err = c.Acquire(ctx, Request{CPUs: 8})
+	assert.True(t, status.IsFailedPreconditionError(err))
+
+	// the large request waits for memory, the small one behind it waits too although it fits
+	released := make(chan func(), 2)
+	large := acquireAsync(ctx, c, Request{CPUs: 1, MemoryBytes: 2 << 30}, released)
+	time.Sleep(20 * time.Millisecond)
+	small := acquireAsync(ctx, c, Request{CPUs: 1}, released)
+	select {
+	case <-large:
+		t.Fatal("large request admitted without enough memory")
+	case <-small:
+		t.Fatal("small request admitted before the large one")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release2()
+	release2()
+	assert.Nil(t, <-large)
+	assert.Nil(t, <-small)
+	(<-released)()
+	(<-released)()
+	release1()
+	assert.Equal(t, Request{}, c.used)
+}
+
+func TestAcquireCanceled(t *testing.T) {
+	c := New(Request{CPUs: 2, MemoryBytes: 1 << 30}, 0)
+	release, err := c.Acquire(context.Background(), Request{CPUs: 1, MemoryBytes: 1 << 30})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	released := make(chan func(), 1)
+	blocked := acquireAsync(ctx, c, Request{CPUs: 1, MemoryBytes: 1}, released)
+	time.Sleep(20 * time.Millisecond)
+	behind := acquireAsync(context.Background(), c, Request{CPUs: 1}, released)
+	time.Sleep(20 * time.Millisecond)
+
+	// the request behind the canceled one is admitted at once
+	cancel()
+	assert.True(t, status.IsCanceledError(<-blocked))
+	assert.Nil(t, <-behind)
+	(<-released)()
+	release()
+	assert.Equal(t, Request{}, c.used)
+}
+
+func TestWaitAvailable(t *testing.T) {
+	c := New(Request{CPUs: 1, MemoryBytes: 1 << 30}, 0)
+	assert.Nil(t, c.WaitAvailable(context.Background()))
+	release, err := c.Acquire(context.Background(), Request{CPUs: 1})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.True(t, status.IsCanceledError(c.WaitAvailable(ctx)))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	assert.Nil(t, c.WaitAvailable(context.Background()))
+}
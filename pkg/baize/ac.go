@@ -2,9 +2,11 @@ package baize
 
 import (
 	"context"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/dashjay/baize/pkg/config"
 	"github.com/dashjay/baize/pkg/interfaces"
 	"github.com/dashjay/baize/pkg/utils/status"
 
@@ -26,6 +28,9 @@ func (s *ExecutorServer) GetActionResult(ctx context.Context, in *repb.GetAction
 	if err := proto.Unmarshal(data, out); err != nil {
 		return nil, err
 	}
+	if s.expired(in.GetInstanceName(), out) {
+		return nil, status.NotFoundErrorf("action result of %s expired", in.GetActionDigest().GetHash())
+	}
 	return out, nil
 }
 
@@ -45,7 +50,7 @@ func (s *ExecutorServer) getActionFromDigest(ctx context.Context, digest *repb.D
 	}
 	data, err := casCache.Get(ctx, digest)
 	if err != nil {
-		return nil, err
+		return nil, notFoundAsMissing(err, digest)
 	}
 	out := &repb.Action{}
 	if err := proto.Unmarshal(data, out); err != nil {
@@ -66,3 +71,42 @@ func (s *ExecutorServer) putActionResultByDigest(ctx context.Context, digest *re
 	}
 	return acCache.Set(ctx, digest, data)
 }
+
+// cachePolicy returns the action cache policy of instance, failures are not cached by default
+func (s *ExecutorServer) cachePolicy(instanceName string) config.ActionCachePolicy {
+	if s.actionCache == nil {
+		return config.ActionCachePolicy{}
+	}
+	return s.actionCache.Policy(instanceName)
+}
+
+// shouldCache reports whether the result of an executed action should be stored in the action cache
+func (s *ExecutorServer) shouldCache(instanceName string, action *repb.Action, actionResult *repb.ActionResult) bool {
+	if action.GetDoNotCache() {
+		return false
+	}
+	return actionResult.GetExitCode() == 0 || s.cachePolicy(instanceName).CacheFailures
+}
+
+// reusable reports whether Execute may answer with a cached result instead of executing the action,
+// failures are only reused while the policy caches failures
+func (s *ExecutorServer) reusable(instanceName string, actionResult *repb.ActionResult) bool {
+	if actionResult.GetExitCode() != 0 && !s.cachePolicy(instanceName).CacheFailures {
+		return false
+	}
+	return !s.expired(instanceName, actionResult)
+}
+
+// expired reports whether a cached failure is older than failure_ttl since the action completed,
+// the ttl applies while the policy caches failures
+func (s *ExecutorServer) expired(instanceName string, actionResult *repb.ActionResult) bool {
+	if actionResult.GetExitCode() == 0 {
+		return false
+	}
+	policy := s.cachePolicy(instanceName)
+	if !policy.CacheFailures || policy.FailureTTL <= 0 {
+		return false
+	}
+	completed := actionResult.GetExecutionMetadata().GetWorkerCompletedTimestamp()
+	return completed == nil || time.Since(completed.AsTime()) > time.Duration(policy.FailureTTL)*time.Second
+}
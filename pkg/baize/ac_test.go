@@ -0,0 +1,129 @@
+package baize
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils/digest"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+var _ = Describe("test action cache policy", func() {
+	var (
+		ctx     = context.Background()
+		s       *ExecutorServer
+		cas     interfaces.Cache
+		workDir string
+	)
+	// execute runs script as an action of instance and returns the response of the operation
+	execute := func(instanceName, script string, doNotCache bool) (*repb.Digest, *repb.ExecuteResponse) {
+		action := &repb.Action{
+			CommandDigest:   putProto(cas, &repb.Command{Arguments: []string{"sh", "-c", script}, OutputFiles: []string{"out"}}),
+			InputRootDigest: putProto(cas, &repb.Directory{}),
+			DoNotCache:      doNotCache,
+		}
+		ad := putProto(cas, action)
+		op := newOperation("op-"+ad.GetHash(), digest.NewResourceName(ad, instanceName), func() {})
+		s.execute(ctx, op, action, nil, 0)
+		stage, rsp, _ := op.snapshot()
+		Expect(stage).To(Equal(repb.ExecutionStage_COMPLETED))
+		return ad, rsp
+	}
+	BeforeEach(func() {
+		var err error
+		workDir, err = ioutil.TempDir("", "action-cache-policy-test-")
+		Expect(err).To(BeNil())
+		s = newTestServer(workDir)
+		s.actionCache = &config.ActionCacheConfig{
+			Instances: map[string]config.ActionCachePolicy{"flaky": {CacheFailures: true, FailureTTL: 60}},
+		}
+		cas = casOf(s)
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(workDir)).To(BeNil())
+	})
+	It("cache results of successful actions only", func() {
+		ad, rsp := execute("", "echo ok > out", false)
+		Expect(rsp.GetResult().GetExitCode()).To(Equal(int32(0)))
+		_, err := s.GetActionResult(ctx, &repb.GetActionResultRequest{ActionDigest: ad})
+		Expect(err).To(BeNil())
+
+		ad, rsp = execute("", "echo failed > out; exit 1", false)
+		Expect(rsp.GetResult().GetExitCode()).To(Equal(int32(1)))
+		_, err = s.GetActionResult(ctx, &repb.GetActionResultRequest{ActionDigest: ad})
+		Expect(status.IsNotFoundError(err)).To(BeTrue())
+		// outputs of failed actions are still available to the client
+		_, err = cas.Get(ctx, rsp.GetResult().GetOutputFiles()[0].GetDigest())
+		Expect(err).To(BeNil())
+
+		// failures uploaded by clients are stored and served, but not reused by Execute
+		_, err = s.UpdateActionResult(ctx, &repb.UpdateActionResultRequest{ActionDigest: ad, ActionResult: rsp.GetResult()})
+		Expect(err).To(BeNil())
+		ar, err := s.GetActionResult(ctx, &repb.GetActionResultRequest{ActionDigest: ad})
+		Expect(err).To(BeNil())
+		Expect(ar.GetExitCode()).To(Equal(int32(1)))
+		Expect(s.reusable("", ar)).To(BeFalse())
+	})
+	It("never cache actions with do_not_cache but upload their outputs", func() {
+		ad, rsp := execute("", "echo uncached > out", true)
+		Expect(rsp.GetResult().GetExitCode()).To(Equal(int32(0)))
+		_, err := s.GetActionResult(ctx, &repb.GetActionResultRequest{ActionDigest: ad})
+		Expect(status.IsNotFoundError(err)).To(BeTrue())
+		data, err := cas.Get(ctx, rsp.GetResult().GetOutputFiles()[0].GetDigest())
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal("uncached\n"))
+	})
+	It("never merge executions of do_not_cache actions", func() {
+		action := &repb.Action{
+			CommandDigest:   putProto(cas, &repb.Command{Arguments: []string{"sh", "-c", "sleep 0.2"}}),
+			InputRootDigest: putProto(cas, &repb.Directory{}),
+		}
+		start := func() *operation {
+			r := digest.NewResourceName(putProto(cas, action), "")
+			name, err := r.UploadString()
+			Expect(err).To(BeNil())
+			return s.startOperation(name, r, action, nil, 0)
+		}
+		completed := func(op *operation) func() repb.ExecutionStage_Value {
+			return func() repb.ExecutionStage_Value {
+				stage, _, _ := op.snapshot()
+				return stage
+			}
+		}
+		first := start()
+		Expect(start()).To(BeIdenticalTo(first))
+		Eventually(completed(first), 5).Should(Equal(repb.ExecutionStage_COMPLETED))
+
+		action.DoNotCache = true
+		first = start()
+		second := start()
+		Expect(second).NotTo(BeIdenticalTo(first))
+		Eventually(completed(first), 5).Should(Equal(repb.ExecutionStage_COMPLETED))
+		Eventually(completed(second), 5).Should(Equal(repb.ExecutionStage_COMPLETED))
+	})
+	It("cache failures for failure_ttl of instance", func() {
+		ad, rsp := execute("flaky", "echo failed > out; exit 1", false)
+		Expect(rsp.GetResult().GetExitCode()).To(Equal(int32(1)))
+		ar, err := s.GetActionResult(ctx, &repb.GetActionResultRequest{ActionDigest: ad, InstanceName: "flaky"})
+		Expect(err).To(BeNil())
+		Expect(ar.GetExitCode()).To(Equal(int32(1)))
+
+		ar.ExecutionMetadata.WorkerCompletedTimestamp = timestamppb.New(time.Now().Add(-2 * time.Minute))
+		Expect(s.expired("flaky", ar)).To(BeTrue())
+		Expect(s.reusable("flaky", ar)).To(BeFalse())
+		Expect(s.expired("", ar)).To(BeFalse())
+		Expect(s.reusable("", ar)).To(BeFalse())
+		ar.ExecutionMetadata.WorkerCompletedTimestamp = timestamppb.Now()
+		Expect(s.reusable("flaky", ar)).To(BeTrue())
+		Expect(s.reusable("", &repb.ActionResult{})).To(BeTrue())
+	})
+})
@@ -18,6 +18,9 @@ import (
 func (s *ExecutorServer) Read(in *bytestream.ReadRequest, server bytestream.ByteStream_ReadServer) error {
 	logrus.Tracef("invoke read from %s", in.GetResourceName())
 	ctx := context.Background()
+	if isLogStreamName(in.GetResourceName()) {
+		return s.readLogStream(in, server)
+	}
 	// Parse resource name per Bazel API specification
 	resource, err := ParseReadResource(in.GetResourceName())
 	if err != nil {
@@ -109,7 +112,13 @@ func (s *ExecutorServer) Write(stream bytestream.ByteStream_WriteServer) error {
 	if err != nil {
 		return status.InternalErrorf("get writer error: %s", err)
 	}
-	defer wc.Close()
+	// corrupted or interrupted writes must not replace what is stored under the digest
+	closed := false
+	defer func() {
+		if !closed {
+			wc.Abort()
+		}
+	}()
 	h := sha256.New()
 	var committed int64
 	mw := io.MultiWriter(wc, h)
@@ -146,6 +155,10 @@ func (s *ExecutorServer) Write(stream bytestream.ByteStream_WriteServer) error {
 		}).Error(msg)
 		return status.InvalidArgumentError(msg)
 	}
+	closed = true
+	if err := wc.Close(); err != nil {
+		return status.InternalErrorf("close writer error: %s", err)
+	}
 	if err := stream.SendAndClose(&bytestream.WriteResponse{CommittedSize: committed}); err != nil {
 		return status.InternalErrorf("Error during SendAndClose(): %s", err)
 	}
@@ -2,10 +2,13 @@ package baize
 
 import (
 	"context"
+	"strconv"
+	"sync"
 
 	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils"
 
-	nstatus "google.golang.org/genproto/googleapis/rpc/status"
+	gstatus "google.golang.org/grpc/status"
 
 	"github.com/dashjay/baize/pkg/utils/status"
 
@@ -34,51 +37,211 @@ func (s *ExecutorServer) FindMissingBlobs(ctx context.Context, in *repb.FindMiss
 	logrus.Debugf("Received CAS FindMissingBlobs request, InstanceName: %s, Blobs size: %d, Misssing Item Nums: %d", in.GetInstanceName(), len(in.GetBlobDigests()), len(ret.MissingBlobDigests))
 	return ret, nil
 }
+
+// BatchUpdateBlobs verifies and stores blobs concurrently, failures of blobs are reported by their statuses
 func (s *ExecutorServer) BatchUpdateBlobs(ctx context.Context, in *repb.BatchUpdateBlobsRequest) (*repb.BatchUpdateBlobsResponse, error) {
-	logrus.Tracef("invoke BatchUpdateBlobs with %#v", in)
-	resp := &repb.BatchUpdateBlobsResponse{}
-	for i := range in.Requests {
-		d := in.Requests[i].GetDigest()
-		wr, err := s.cache.Writer(ctx, d)
+	logrus.Tracef("invoke BatchUpdateBlobs with %d blobs", len(in.GetRequests()))
+	var total int64
+	for _, r := range in.GetRequests() {
+		total += int64(len(r.GetData()))
+	}
+	if total > maxBatchTotalSize {
+		return nil, status.InvalidArgumentErrorf("batch of %d bytes exceeds max_batch_total_size %d", total, maxBatchTotalSize)
+	}
+	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, in.GetInstanceName())
+	if err != nil {
+		return nil, err
+	}
+	requests := in.GetRequests()
+	resp := &repb.BatchUpdateBlobsResponse{Responses: make([]*repb.BatchUpdateBlobsResponse_Response, len(requests))}
+	forEachBlob(len(requests), func(i int) {
+		d := requests[i].GetDigest()
+		err := updateBlob(ctx, casCache, requests[i])
 		if err != nil {
-			return resp, err
-		}
-		_, err = wr.Write(in.Requests[i].GetData())
-		wr.Close()
-		if err == nil {
-			resp.Responses = append(resp.Responses, &repb.BatchUpdateBlobsResponse_Response{Digest: d, Status: &nstatus.Status{Code: 0, Message: "success"}})
-		} else {
-			resp.Responses = append(resp.Responses, &repb.BatchUpdateBlobsResponse_Response{Digest: d, Status: &nstatus.Status{Code: 1, Message: "success"}})
+			logrus.WithError(err).Debugf("update blob %s/%d error", d.GetHash(), d.GetSizeBytes())
 		}
-	}
+		resp.Responses[i] = &repb.BatchUpdateBlobsResponse_Response{Digest: d, Status: gstatus.Convert(err).Proto()}
+	})
 	return resp, nil
 }
+
+func updateBlob(ctx context.Context, casCache interfaces.Cache, r *repb.BatchUpdateBlobsRequest_Request) error {
+	d := r.GetDigest()
+	if !IsValidDigest(d.GetHash(), d.GetSizeBytes()) {
+		return status.InvalidArgumentErrorf("invalid digest %s/%d", d.GetHash(), d.GetSizeBytes())
+	}
+	if r.GetCompressor() != repb.Compressor_IDENTITY {
+		return status.InvalidArgumentErrorf("compressor %s is not supported", r.GetCompressor())
+	}
+	if actual := utils.CalSHA256OfInput(r.GetData()); actual.GetHash() != d.GetHash() || actual.GetSizeBytes() != d.GetSizeBytes() {
+		return status.InvalidArgumentErrorf("data hashes to %s/%d instead of %s/%d", actual.GetHash(), actual.GetSizeBytes(), d.GetHash(), d.GetSizeBytes())
+	}
+	// empty blobs are never stored
+	if d.GetHash() == EmptySha {
+		return nil
+	}
+	if d.GetSizeBytes() > casCache.MaxBlobSize() {
+		return status.ResourceExhaustedErrorf("blob of %d bytes exceeds %d bytes the cache accepts", d.GetSizeBytes(), casCache.MaxBlobSize())
+	}
+	return casCache.Set(ctx, d, r.GetData())
+}
+
+// BatchReadBlobs reads blobs concurrently, failures of blobs are reported by their statuses
 func (s *ExecutorServer) BatchReadBlobs(ctx context.Context, in *repb.BatchReadBlobsRequest) (*repb.BatchReadBlobsResponse, error) {
+	logrus.Tracef("invoke BatchReadBlobs with %d blobs", len(in.GetDigests()))
 	digests := in.GetDigests()
+	var total int64
+	for _, d := range digests {
+		total += d.GetSizeBytes()
+	}
+	if total > maxBatchTotalSize {
+		return nil, status.InvalidArgumentErrorf("batch of %d bytes exceeds max_batch_total_size %d", total, maxBatchTotalSize)
+	}
 	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, in.GetInstanceName())
 	if err != nil {
 		return nil, err
 	}
+	resp := &repb.BatchReadBlobsResponse{Responses: make([]*repb.BatchReadBlobsResponse_Response, len(digests))}
+	forEachBlob(len(digests), func(i int) {
+		data, err := readBlob(ctx, casCache, digests[i])
+		resp.Responses[i] = &repb.BatchReadBlobsResponse_Response{Digest: digests[i], Data: data, Status: gstatus.Convert(err).Proto()}
+	})
+	return resp, nil
+}
 
-	var responses []*repb.BatchReadBlobsResponse_Response
-	for k := range digests {
-		outs, err := casCache.Get(ctx, digests[k])
-		resp := &repb.BatchReadBlobsResponse_Response{
-			Digest: digests[k],
-			Data:   outs,
-		}
-		if err != nil {
-			resp.Status = &nstatus.Status{Code: 1, Message: err.Error()}
-		} else {
-			resp.Status = &nstatus.Status{Code: 0, Message: err.Error()}
-		}
-		responses = append(responses, resp)
+func readBlob(ctx context.Context, casCache interfaces.Cache, d *repb.Digest) ([]byte, error) {
+	if !IsValidDigest(d.GetHash(), d.GetSizeBytes()) {
+		return nil, status.InvalidArgumentErrorf("invalid digest %s/%d", d.GetHash(), d.GetSizeBytes())
 	}
-	return &repb.BatchReadBlobsResponse{Responses: responses}, nil
+	if d.GetHash() == EmptySha {
+		return nil, nil
+	}
+	data, err := casCache.Get(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != d.GetSizeBytes() {
+		return nil, status.NotFoundErrorf("blob %s has %d bytes instead of %d", d.GetHash(), len(data), d.GetSizeBytes())
+	}
+	return data, nil
 }
+
+// forEachBlob calls fn with indexes of blobs in a batch, at most batchConcurrency at the same time
+func forEachBlob(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, batchConcurrency)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// GetTree streams Directory protos under root_digest in breadth first order, each directory once, a page holds
+// at most page_size directories and page_token is the offset of the first directory of the page in that order.
+// Subtrees of directories missing in CAS are omitted, a missing root is NOT_FOUND.
 func (s *ExecutorServer) GetTree(in *repb.GetTreeRequest, server repb.ContentAddressableStorage_GetTreeServer) error {
 	logrus.Tracef("invoke GetTree with %#v", in)
-	err := status.UnimplementedError("This service does not support GetTree")
-	logrus.WithError(err).Error("Unimplemented")
-	return err
+	if in.GetRootDigest() == nil {
+		return status.InvalidArgumentError("root_digest is required")
+	}
+	offset := 0
+	if in.GetPageToken() != "" {
+		var err error
+		if offset, err = strconv.Atoi(in.GetPageToken()); err != nil || offset < 0 {
+			return status.InvalidArgumentErrorf("invalid page_token %q", in.GetPageToken())
+		}
+	}
+	pageSize := int(in.GetPageSize())
+	if pageSize <= 0 || pageSize > maxGetTreePageSize {
+		pageSize = maxGetTreePageSize
+	}
+	ctx := server.Context()
+	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, in.GetInstanceName())
+	if err != nil {
+		return err
+	}
+	page := &repb.GetTreeResponse{}
+	sent, index := false, 0
+	err = s.walkTree(ctx, casCache, in.GetRootDigest(), func(dir *repb.Directory) error {
+		index++
+		if index <= offset {
+			return nil
+		}
+		if len(page.Directories) == pageSize {
+			page.NextPageToken = strconv.Itoa(index - 1)
+			if err := server.Send(page); err != nil {
+				return err
+			}
+			page, sent = &repb.GetTreeResponse{}, true
+		}
+		page.Directories = append(page.Directories, dir)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(page.Directories) > 0 || !sent {
+		return server.Send(page)
+	}
+	return nil
+}
+
+// walkTree calls fn with directories under root level by level, directories of one level are fetched together.
+func (s *ExecutorServer) walkTree(ctx context.Context, casCache interfaces.Cache, root *repb.Digest, fn func(*repb.Directory) error) error {
+	seen := map[string]bool{directoryKey(root): true}
+	level := []*repb.Digest{root}
+	for len(level) > 0 {
+		var stored []*repb.Digest
+		for _, d := range level {
+			if d.GetHash() != EmptySha {
+				stored = append(stored, d)
+			}
+		}
+		absentKeys := make(map[string]bool)
+		if len(stored) > 0 {
+			absent, err := casCache.FindMissing(ctx, stored)
+			if err != nil {
+				return err
+			}
+			for _, d := range absent {
+				if d.GetHash() == root.GetHash() {
+					return status.NotFoundErrorf("root directory %s/%d not found", root.GetHash(), root.GetSizeBytes())
+				}
+				logrus.Debugf("directory %s/%d is missing, omit it from tree", d.GetHash(), d.GetSizeBytes())
+				absentKeys[directoryKey(d)] = true
+			}
+		}
+		var present []*repb.Digest
+		for _, d := range level {
+			if !absentKeys[directoryKey(d)] {
+				present = append(present, d)
+			}
+		}
+		dirs, err := s.getDirectories(ctx, casCache, present)
+		if err != nil {
+			return err
+		}
+		var next []*repb.Digest
+		for _, dir := range dirs {
+			if err := fn(dir); err != nil {
+				return err
+			}
+			for _, child := range dir.GetDirectories() {
+				if key := directoryKey(child.GetDigest()); !seen[key] {
+					seen[key] = true
+					next = append(next, child.GetDigest())
+				}
+			}
+		}
+		level = next
+	}
+	return nil
 }
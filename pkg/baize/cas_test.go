@@ -0,0 +1,140 @@
+package baize
+
+import (
+	"context"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+type fakeGetTreeServer struct {
+	grpc.ServerStream
+	ctx   context.Context
+	pages []*repb.GetTreeResponse
+}
+
+func (f *fakeGetTreeServer) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeGetTreeServer) Send(resp *repb.GetTreeResponse) error {
+	f.pages = append(f.pages, resp)
+	return nil
+}
+
+var _ = Describe("test content addressable storage", func() {
+	var (
+		ctx = context.Background()
+		s   *ExecutorServer
+		cas interfaces.Cache
+	)
+	// getTree returns pages of GetTree and the names of the first file of every directory in them
+	getTree := func(in *repb.GetTreeRequest) ([]*repb.GetTreeResponse, [][]string, error) {
+		server := &fakeGetTreeServer{ctx: ctx}
+		err := s.GetTree(in, server)
+		var names [][]string
+		for _, page := range server.pages {
+			var pageNames []string
+			for _, dir := range page.GetDirectories() {
+				name := ""
+				if len(dir.GetFiles()) > 0 {
+					name = dir.GetFiles()[0].GetName()
+				}
+				pageNames = append(pageNames, name)
+			}
+			names = append(names, pageNames)
+		}
+		return server.pages, names, err
+	}
+	BeforeEach(func() {
+		s = newTestServer("")
+		cas = casOf(s)
+	})
+	It("get tree breadth first by pages", func() {
+		file := func(name string) []*repb.FileNode {
+			return []*repb.FileNode{{Name: name, Digest: utils.CalSHA256OfInput([]byte(name))}}
+		}
+		c := putProto(cas, &repb.Directory{Files: file("c")})
+		missing := utils.CalSHA256OfInput([]byte("not a directory"))
+		a := putProto(cas, &repb.Directory{Files: file("a"), Directories: []*repb.DirectoryNode{{Name: "c", Digest: c}}})
+		b := putProto(cas, &repb.Directory{Files: file("b"), Directories: []*repb.DirectoryNode{
+			{Name: "c", Digest: c}, {Name: "missing", Digest: missing},
+		}})
+		root := putProto(cas, &repb.Directory{Files: file("root"), Directories: []*repb.DirectoryNode{
+			{Name: "a", Digest: a}, {Name: "b", Digest: b}, {Name: "empty", Digest: utils.CalSHA256OfInput(nil)},
+		}})
+
+		pages, names, err := getTree(&repb.GetTreeRequest{RootDigest: root, PageSize: 2})
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([][]string{{"root", "a"}, {"b", ""}, {"c"}}))
+		Expect(pages[0].GetNextPageToken()).NotTo(BeEmpty())
+		Expect(pages[2].GetNextPageToken()).To(BeEmpty())
+
+		_, names, err = getTree(&repb.GetTreeRequest{RootDigest: root, PageSize: 2, PageToken: pages[0].GetNextPageToken()})
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([][]string{{"b", ""}, {"c"}}))
+
+		_, names, err = getTree(&repb.GetTreeRequest{RootDigest: root})
+		Expect(err).To(BeNil())
+		Expect(names).To(Equal([][]string{{"root", "a", "b", "", "c"}}))
+	})
+	It("reject missing root and invalid page token", func() {
+		_, _, err := getTree(&repb.GetTreeRequest{RootDigest: utils.CalSHA256OfInput([]byte("not a directory"))})
+		Expect(status.IsNotFoundError(err)).To(BeTrue())
+
+		root := putProto(cas, &repb.Directory{})
+		_, _, err = getTree(&repb.GetTreeRequest{RootDigest: root, PageToken: "not an offset"})
+		Expect(status.IsInvalidArgumentError(err)).To(BeTrue())
+	})
+	It("update and read blobs of a batch with status of each", func() {
+		data := []byte("blob")
+		d := utils.CalSHA256OfInput(data)
+		tooLarge := make([]byte, 1<<20+1)
+		updated, err := s.BatchUpdateBlobs(ctx, &repb.BatchUpdateBlobsRequest{InstanceName: "instance", Requests: []*repb.BatchUpdateBlobsRequest_Request{
+			{Digest: d, Data: data},
+			{Digest: d, Data: []byte("corrupted")},
+			{Digest: utils.CalSHA256OfInput(tooLarge), Data: tooLarge},
+			{Digest: utils.CalSHA256OfInput(nil)},
+		}})
+		Expect(err).To(BeNil())
+		var got []codes.Code
+		for _, r := range updated.GetResponses() {
+			got = append(got, codes.Code(r.GetStatus().GetCode()))
+		}
+		Expect(got).To(Equal([]codes.Code{codes.OK, codes.InvalidArgument, codes.ResourceExhausted, codes.OK}))
+
+		missing := utils.CalSHA256OfInput([]byte("never uploaded"))
+		read, err := s.BatchReadBlobs(ctx, &repb.BatchReadBlobsRequest{InstanceName: "instance", Digests: []*repb.Digest{
+			d, missing, {Hash: "invalid"}, utils.CalSHA256OfInput(nil),
+		}})
+		Expect(err).To(BeNil())
+		Expect(read.GetResponses()).To(HaveLen(4))
+		Expect(read.GetResponses()[0].GetData()).To(Equal(data))
+		got = nil
+		for _, r := range read.GetResponses() {
+			got = append(got, codes.Code(r.GetStatus().GetCode()))
+		}
+		Expect(got).To(Equal([]codes.Code{codes.OK, codes.NotFound, codes.InvalidArgument, codes.OK}))
+	})
+	It("reject batches larger than max batch total size", func() {
+		caps, err := s.GetCapabilities(ctx, &repb.GetCapabilitiesRequest{})
+		Expect(err).To(BeNil())
+		limit := caps.GetCacheCapabilities().GetMaxBatchTotalSizeBytes()
+		Expect(limit).To(BeNumerically(">", 0))
+
+		data := make([]byte, limit+1)
+		_, err = s.BatchUpdateBlobs(ctx, &repb.BatchUpdateBlobsRequest{Requests: []*repb.BatchUpdateBlobsRequest_Request{
+			{Digest: utils.CalSHA256OfInput(data), Data: data},
+		}})
+		Expect(status.IsInvalidArgumentError(err)).To(BeTrue())
+		_, err = s.BatchReadBlobs(ctx, &repb.BatchReadBlobsRequest{Digests: []*repb.Digest{utils.CalSHA256OfInput(data)}})
+		Expect(status.IsInvalidArgumentError(err)).To(BeTrue())
+	})
+})
@@ -11,6 +11,16 @@ const (
 	// Resource naming constants
 	ResourceNameType   = "blobs"
 	ResourceNameAction = "uploads"
+	// ResourceNameLogStreams is the resource type of live stdout and stderr of executing actions
+	ResourceNameLogStreams = "logstreams"
+
+	// maxGetTreePageSize is the limit of directories in a page of GetTree
+	maxGetTreePageSize = 1000
+
+	// maxBatchTotalSize is the limit of bytes of blobs in a batch request, advertised in capabilities
+	maxBatchTotalSize = 4 * 1024 * 1024
+	// batchConcurrency bounds blobs of a batch request read or written at the same time
+	batchConcurrency = 16
 
 	// Default buffer sizes
 	DefaultReadCapacity = 1024 * 1024
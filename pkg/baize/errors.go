@@ -0,0 +1,52 @@
+package baize
+
+import (
+	"fmt"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	gstatus "google.golang.org/grpc/status"
+
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// missingViolationType is the type of PreconditionFailure violations of blobs missing in CAS
+const missingViolationType = "MISSING"
+
+// missingBlobsError returns FAILED_PRECONDITION with a MISSING violation for every digest, so that
+// clients upload the blobs and execute the action again.
+func missingBlobsError(digests ...*repb.Digest) error {
+	failure := &errdetails.PreconditionFailure{}
+	for _, d := range digests {
+		failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+			Type:    missingViolationType,
+			Subject: fmt.Sprintf("blobs/%s/%d", d.GetHash(), d.GetSizeBytes()),
+		})
+	}
+	s, err := gstatus.New(codes.FailedPrecondition, fmt.Sprintf("%d blobs missing in CAS", len(digests))).WithDetails(failure)
+	if err != nil {
+		return status.FailedPreconditionErrorf("%d blobs missing in CAS", len(digests))
+	}
+	return s.Err()
+}
+
+// notFoundAsMissing converts NOT_FOUND of reading d from CAS into a missing blob error
+func notFoundAsMissing(err error, d *repb.Digest) error {
+	if status.IsNotFoundError(err) {
+		return missingBlobsError(d)
+	}
+	return err
+}
+
+// infrastructureError tells failures of the executor apart from failures of the action,
+// errors without a gRPC code, e.g. I/O errors of the executor, are UNAVAILABLE so that the action is retried.
+func infrastructureError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := gstatus.FromError(err); ok {
+		return err
+	}
+	return status.UnavailableErrorf("executor error: %s", err)
+}
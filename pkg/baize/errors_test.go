@@ -0,0 +1,87 @@
+package baize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	gstatus "google.golang.org/grpc/status"
+
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// missingSubjects returns subjects of MISSING violations in err
+func missingSubjects(err error) []string {
+	s, _ := gstatus.FromError(err)
+	Expect(s.Code()).To(Equal(codes.FailedPrecondition))
+	var subjects []string
+	for _, detail := range s.Details() {
+		if failure, ok := detail.(*errdetails.PreconditionFailure); ok {
+			for _, v := range failure.GetViolations() {
+				Expect(v.GetType()).To(Equal(missingViolationType))
+				subjects = append(subjects, v.GetSubject())
+			}
+		}
+	}
+	return subjects
+}
+
+var _ = Describe("test execution errors", func() {
+	var (
+		ctx     = context.Background()
+		s       *ExecutorServer
+		cas     interfaces.Cache
+		workDir string
+	)
+	BeforeEach(func() {
+		var err error
+		workDir, err = ioutil.TempDir("", "execution-errors-test-")
+		Expect(err).To(BeNil())
+		s = newTestServer(workDir)
+		cas = casOf(s)
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(workDir)).To(BeNil())
+	})
+	It("report all missing inputs and command as precondition failure", func() {
+		subject := func(d *repb.Digest) string {
+			return fmt.Sprintf("blobs/%s/%d", d.GetHash(), d.GetSizeBytes())
+		}
+		missingFile := utils.CalSHA256OfInput([]byte("never uploaded"))
+		missingDeepFile := utils.CalSHA256OfInput([]byte("never uploaded either"))
+		missingDir := utils.CalSHA256OfInput([]byte("not a directory"))
+		missingCommand := utils.CalSHA256OfInput([]byte("not a command"))
+		sub := putProto(cas, &repb.Directory{
+			Files:       []*repb.FileNode{{Name: "deep", Digest: missingDeepFile}, {Name: "again", Digest: missingFile}},
+			Directories: []*repb.DirectoryNode{{Name: "empty", Digest: utils.CalSHA256OfInput(nil)}},
+		})
+		root := putProto(cas, &repb.Directory{
+			Files:       []*repb.FileNode{{Name: "input", Digest: missingFile}},
+			Directories: []*repb.DirectoryNode{{Name: "sub", Digest: sub}, {Name: "lost", Digest: missingDir}},
+		})
+		_, err := s.runWorker(ctx, &repb.Action{CommandDigest: missingCommand, InputRootDigest: root}, nil, nil)
+		Expect(missingSubjects(err)).To(ConsistOf(subject(missingDir), subject(missingCommand), subject(missingFile), subject(missingDeepFile)))
+
+		command := putProto(cas, &repb.Command{Arguments: []string{"true"}})
+		_, err = s.runWorker(ctx, &repb.Action{CommandDigest: command, InputRootDigest: missingDir}, nil, nil)
+		Expect(missingSubjects(err)).To(Equal([]string{subject(missingDir)}))
+
+		_, err = s.getActionFromDigest(ctx, missingCommand)
+		Expect(missingSubjects(err)).To(Equal([]string{subject(missingCommand)}))
+	})
+	It("tell infrastructure failures apart from action failures", func() {
+		Expect(infrastructureError(nil)).To(BeNil())
+		Expect(status.IsUnavailableError(infrastructureError(errors.New("no space left on device")))).To(BeTrue())
+		Expect(status.IsDeadlineExceededError(infrastructureError(status.DeadlineExceededError("timeout")))).To(BeTrue())
+		Expect(status.IsFailedPreconditionError(infrastructureError(missingBlobsError()))).To(BeTrue())
+	})
+})
@@ -1,22 +1,23 @@
 package baize
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"google.golang.org/protobuf/types/known/anypb"
 
 	"google.golang.org/grpc/codes"
+	gstatus "google.golang.org/grpc/status"
 
 	"github.com/dashjay/baize/pkg/utils/digest"
+	"github.com/dashjay/baize/pkg/utils/platform"
 
 	"google.golang.org/protobuf/types/known/timestamppb"
 
@@ -28,8 +29,9 @@ import (
 	googlestatus "google.golang.org/genproto/googleapis/rpc/status"
 
 	"github.com/dashjay/baize/pkg/interfaces"
+	schedulerpb "github.com/dashjay/baize/pkg/proto/scheduler"
+	"github.com/dashjay/baize/pkg/scheduler"
 	"github.com/dashjay/baize/pkg/utils"
-	"github.com/dashjay/baize/pkg/utils/commandutil"
 	"github.com/dashjay/baize/pkg/utils/status"
 )
 
@@ -61,8 +63,10 @@ func ValidateActionResult(ctx context.Context, cache interfaces.Cache, r *repb.A
 	var wg sync.WaitGroup
 
 	for idx := range r.OutputDirectories {
+		appendDigest(r.OutputDirectories[idx].GetTreeDigest())
 		wg.Add(1)
 		go func(i int) {
+			defer wg.Done()
 			blob, err := cache.Get(ctx, r.OutputDirectories[i].GetTreeDigest())
 			if err != nil {
 				logrus.WithError(err).Errorf("get %s while validating action reseult error", r.OutputDirectories[i].GetTreeDigest())
@@ -90,11 +94,14 @@ func Assemble(stage repb.ExecutionStage_Value, name string, r *digest.ResourceNa
 	if r == nil || er == nil {
 		return nil, status.FailedPreconditionError("digest or execute response are both required to assemble operation")
 	}
-
-	metadata, err := anypb.New(&repb.ExecuteOperationMetadata{
+	return assembleOperation(name, &repb.ExecuteOperationMetadata{
 		Stage:        stage,
 		ActionDigest: r.GetDigest(),
-	})
+	}, er)
+}
+
+func assembleOperation(name string, eom *repb.ExecuteOperationMetadata, er *repb.ExecuteResponse) (*longrunning.Operation, error) {
+	metadata, err := anypb.New(eom)
 	if err != nil {
 		return nil, err
 	}
@@ -108,7 +115,7 @@ func Assemble(stage repb.ExecutionStage_Value, name string, r *digest.ResourceNa
 	}
 	operation.Result = &longrunning.Operation_Response{Response: result}
 
-	if stage == repb.ExecutionStage_COMPLETED {
+	if eom.GetStage() == repb.ExecutionStage_COMPLETED {
 		operation.Done = true
 	}
 	return operation, nil
@@ -127,14 +134,17 @@ func GetStateChangeFunc(stream StreamLike, taskID string, adInstanceDigest *dige
 		if err != nil {
 			return status.InternalErrorf("Error updating state of %q: %s", taskID, err)
 		}
+		return sendOperation(stream, op)
+	}
+}
 
-		select {
-		case <-stream.Context().Done():
-			logrus.Warningf("Attempted state change on %q but context is done.", taskID)
-			return status.UnavailableErrorf("Context canceled: %s", stream.Context().Err())
-		default:
-			return stream.Send(op)
-		}
+func sendOperation(stream StreamLike, op *longrunning.Operation) error {
+	select {
+	case <-stream.Context().Done():
+		logrus.Warningf("Attempted state change on %q but context is done.", op.GetName())
+		return status.UnavailableErrorf("Context canceled: %s", stream.Context().Err())
+	default:
+		return stream.Send(op)
 	}
 }
 func ExecuteResponseWithResult(ar *repb.ActionResult, code codes.Code) *repb.ExecuteResponse {
@@ -203,197 +213,336 @@ func (s *ExecutorServer) Execute(req *repb.ExecuteRequest, stream repb.Execution
 			if err != nil {
 				return err
 			}
-			err = ValidateActionResult(stream.Context(), casCache, actionResult)
-			if err != nil {
-				return err
-			}
-			stateChangeFn := GetStateChangeFunc(stream, executionID, adInstanceDigest)
-			if err := stateChangeFn(repb.ExecutionStage_COMPLETED, ExecuteResponseWithResult(actionResult, codes.OK)); err != nil {
-				return err
+			// failures not to be reused and results referring to outputs evicted from CAS are executed again
+			if !s.reusable(req.GetInstanceName(), actionResult) {
+				logrus.Debugf("cached result of action %s is not reusable", req.GetActionDigest().GetHash())
+			} else if err := ValidateActionResult(stream.Context(), casCache, actionResult); err != nil {
+				logrus.WithError(err).Warnf("cached result of action %s is invalid", req.GetActionDigest().GetHash())
+			} else {
+				rsp := ExecuteResponseWithResult(actionResult, codes.OK)
+				rsp.CachedResult = true
+				stateChangeFn := GetStateChangeFunc(stream, executionID, adInstanceDigest)
+				return stateChangeFn(repb.ExecutionStage_COMPLETED, rsp)
 			}
-			return nil
 		}
 	}
 
-	// wait req
-	waitReq := &repb.WaitExecutionRequest{Name: executionID}
-	return s.waitExecution(waitReq, stream, waitOpts{isExecuteRequest: true})
-}
-
-type waitOpts struct {
-	isExecuteRequest bool
+	action, err := s.getActionFromDigest(stream.Context(), req.GetActionDigest())
+	if err != nil {
+		return err
+	}
+	if _, err := s.actionTimeout(action); err != nil {
+		return err
+	}
+	required, err := s.actionPlatform(stream.Context(), action)
+	if err != nil {
+		return err
+	}
+	if s.scheduler == nil {
+		if err := platform.Satisfies(s.platform, required); err != nil {
+			return status.FailedPreconditionErrorf("platform of action %s is not satisfied: %s", req.GetActionDigest().GetHash(), err)
+		}
+	}
+	op := s.startOperation(executionID, adInstanceDigest, action, required, req.GetExecutionPolicy().GetPriority())
+	return op.wait(stream)
 }
 
 func InProgressExecuteResponse() *repb.ExecuteResponse {
 	return ExecuteResponseWithResult(nil, codes.OK)
 }
-func (s *ExecutorServer) waitExecution(req *repb.WaitExecutionRequest, stream repb.Execution_WaitExecutionServer, opts waitOpts) error {
-	logrus.Tracef("invoke waitExecution with %#v", req)
-	ctx := stream.Context()
 
-	r, err := digest.ParseUploadResourceName(req.GetName())
+// startOperation registers an operation and executes the action in background,
+// so that the execution survives the stream which started it.
+// If the same action of the same instance is already queued or executing, the existing operation is returned,
+// unless the action is do_not_cache, which must not be merged with other executions.
+func (s *ExecutorServer) startOperation(name string, r *digest.ResourceName, action *repb.Action, required *repb.Platform, priority int32) *operation {
+	ctx, cancel := context.WithCancel(context.Background())
+	op := newOperation(name, r, cancel)
+	op.stdoutStream, op.stderrStream = logStreamNames(r.GetInstanceName())
+	op, merged := s.operations.put(op, !action.GetDoNotCache())
+	if merged {
+		cancel()
+		logrus.Debugf("execution of action %s merged into operation %s", r.GetDigest().GetHash(), op.name)
+		return op
+	}
+	s.logStreams.open(op.stdoutStream)
+	s.logStreams.open(op.stderrStream)
+	go s.execute(ctx, op, action, required, priority)
+	return op
+}
+
+// execute runs the action of operation locally or by executors, errors occurred while running the action
+// are reported in the status of ExecuteResponse.
+func (s *ExecutorServer) execute(ctx context.Context, op *operation, action *repb.Action, required *repb.Platform, priority int32) {
+	defer op.cancel()
+	// log streams are finished however the execution ends, readers would block forever otherwise
+	if op.stdoutStream != "" {
+		defer s.logStreams.finish(op.stdoutStream)
+		defer s.logStreams.finish(op.stderrStream)
+	}
+	r := op.resource
+	var actionResult *repb.ActionResult
+	var err error
+	if s.scheduler != nil {
+		actionResult, err = s.executeRemotely(ctx, op, action, required, priority)
+	} else {
+		actionResult, err = s.admitAndRunLocally(ctx, op, action, required)
+	}
+	if md := actionResult.GetExecutionMetadata(); md != nil {
+		md.QueuedTimestamp = timestamppb.New(op.queued)
+	}
 	if err != nil {
-		logrus.Errorf("could not extract digest from %q: %s", req.GetName(), err)
-		return err
+		logrus.WithError(err).Errorf("execute action %s", r.GetDigest().GetHash())
+		// actionResult holds partial outputs if any, e.g. the action timed out
+		s.operations.complete(op, &repb.ExecuteResponse{Result: actionResult, Status: gstatus.Convert(infrastructureError(err)).Proto()})
+		return
+	}
+	if !s.shouldCache(r.GetInstanceName(), action, actionResult) {
+		logrus.Debugf("result of action %s with exit code %d is not cached", r.GetDigest().GetHash(), actionResult.GetExitCode())
+	} else if err := s.putActionResultByDigest(ctx, r.GetDigest(), actionResult, r.GetInstanceName()); err != nil {
+		logrus.WithError(err).Errorf("putActionResultByDigest")
+		s.operations.complete(op, &repb.ExecuteResponse{Status: gstatus.Convert(err).Proto()})
+		return
 	}
-	if opts.isExecuteRequest {
-		stateChangeFn := GetStateChangeFunc(stream, req.GetName(), r)
-		err = stateChangeFn(repb.ExecutionStage_UNKNOWN, InProgressExecuteResponse())
-		if err != nil && err != io.EOF {
-			logrus.Warningf("Could not send initial update: %s", err)
+	s.operations.complete(op, ExecuteResponseWithResult(actionResult, codes.OK))
+}
+
+// WaitExecution attaches to an operation started by Execute
+func (s *ExecutorServer) WaitExecution(req *repb.WaitExecutionRequest, stream repb.Execution_WaitExecutionServer) error {
+	logrus.Tracef("invoke WaitExecution with %#v", req)
+	op, exists := s.operations.get(req.GetName())
+	if !exists {
+		return status.NotFoundErrorf("operation %s not found", req.GetName())
+	}
+	return op.wait(stream)
+}
+
+// RunJob runs the action of a job pulled from the scheduler and uploads the ActionResult into CAS,
+// the frontend which scheduled the job will read it by the returned digest.
+func (s *ExecutorServer) RunJob(ctx context.Context, job *schedulerpb.GetJobResp, stdout, stderr io.Writer) (*repb.ActionResult, *repb.Digest, error) {
+	actionResult, runErr := s.runWorker(ctx, job.GetJob(), stdout, stderr)
+	if runErr != nil {
+		logrus.WithError(runErr).Errorf("runWorker")
+		// the scheduler retries the job on another executor if it failed for the executor
+		runErr = infrastructureError(runErr)
+		if actionResult == nil {
+			return nil, nil, runErr
 		}
 	}
-	action, err := s.getActionFromDigest(ctx, r.GetDigest())
+	data, err := proto.Marshal(actionResult)
 	if err != nil {
-		return err
-	}
-	// Response
-	eom := &repb.ExecuteOperationMetadata{
-		Stage:            repb.ExecutionStage_EXECUTING,
-		ActionDigest:     r.GetDigest(),
-		StdoutStreamName: "",
-		StderrStreamName: "",
+		return nil, nil, status.InternalErrorf("marshal action result error: %s", err)
 	}
-	eomAsPBAny, err := marshalAny(eom)
+	casCache, err := CASCache(ctx, s.cache, job.GetInstanceName())
 	if err != nil {
-		return status.InternalErrorf("failed to marshal eom: %s", err)
+		return nil, nil, err
 	}
-	op := &longrunning.Operation{
-		Name:     req.GetName(),
-		Metadata: eomAsPBAny,
-		Done:     false,
+	d := utils.CalSHA256OfInput(data)
+	if err := casCache.Set(ctx, d, data); err != nil {
+		logrus.WithError(err).Errorf("upload action result")
+		return nil, nil, infrastructureError(err)
 	}
-	if err := stream.Send(op); err != nil {
-		return err
+	return actionResult, d, runErr
+}
+
+// executeRemotely schedules the action to executors and waits for the ActionResult
+func (s *ExecutorServer) executeRemotely(ctx context.Context, op *operation, action *repb.Action, required *repb.Platform, priority int32) (*repb.ActionResult, error) {
+	name, r := op.name, op.resource
+	job := &scheduler.Job{
+		ID:           name,
+		InstanceName: r.GetInstanceName(),
+		ActionDigest: r.GetDigest(),
+		Action:       action,
+		Platform:     required,
+		Priority:     priority,
+		OnFetch: func() {
+			op.update(repb.ExecutionStage_EXECUTING, nil)
+		},
+		// outputs forwarded by the executor are served by log streams of this server
+		OnLog: func(stderr bool, data []byte) {
+			name := op.stdoutStream
+			if stderr {
+				name = op.stderrStream
+			}
+			if l, exists := s.logStreams.get(name); exists {
+				l.Write(data)
+			}
+		},
+	}
+	if err := s.scheduler.EnqueueJob(job); err != nil {
+		return nil, err
 	}
-	actionResult, err := s.runWorker(ctx, action, s.workDir)
+	result, err := job.Wait(ctx)
 	if err != nil {
-		logrus.WithError(err).Errorf("runWorker")
-		return err
+		// the operation is canceled, stop the job on executor as well
+		s.scheduler.CancelJob(job.ID)
+		return nil, err
 	}
-	if err := s.putActionResultByDigest(ctx, r.GetDigest(), actionResult, r.GetInstanceName()); err != nil {
-		logrus.WithError(err).Errorf("putActionResultByDigest")
-		return err
+	var jobErr error
+	if result.Status.GetCode() != int32(codes.OK) {
+		jobErr = gstatus.ErrorProto(result.Status)
+		if result.ActionResultDigest == nil {
+			return nil, jobErr
+		}
 	}
-	response, err := marshalAny(&repb.ExecuteResponse{
-		Result:  actionResult,
-		Message: "action executing",
-	})
-	if err != nil {
-		logrus.WithError(err).Errorf("marshalAny executeResponse")
-		return err
+	actionResult := &repb.ActionResult{}
+	if err := ReadProtoFromCAS(ctx, s.cache, digest.NewResourceName(result.ActionResultDigest, r.GetInstanceName()), actionResult); err != nil {
+		if jobErr != nil {
+			return nil, jobErr
+		}
+		return nil, status.InternalErrorf("read action result %s of job %s error: %s", result.ActionResultDigest.GetHash(), name, err)
 	}
+	if result.ExecutionMetadata != nil {
+		actionResult.ExecutionMetadata = result.ExecutionMetadata
+	}
+	return actionResult, jobErr
+}
 
-	eom.Stage = repb.ExecutionStage_COMPLETED
-	op.Result = &longrunning.Operation_Response{Response: response}
-	op.Done = true
+// actionTimeout returns how long the action can run, Action.timeout longer than
+// maxActionTimeout is rejected.
+func (s *ExecutorServer) actionTimeout(action *repb.Action) (time.Duration, error) {
+	if action.GetTimeout() == nil {
+		return s.defaultActionTimeout, nil
+	}
+	if err := action.GetTimeout().CheckValid(); err != nil {
+		return 0, status.InvalidArgumentErrorf("invalid action timeout: %s", err)
+	}
+	timeout := action.GetTimeout().AsDuration()
+	if timeout <= 0 {
+		return s.defaultActionTimeout, nil
+	}
+	if timeout > s.maxActionTimeout {
+		return 0, status.InvalidArgumentErrorf("action timeout %s exceeds the max timeout %s", timeout, s.maxActionTimeout)
+	}
+	return timeout, nil
+}
 
-	return stream.Send(op)
+// actionPlatform returns the platform required by action, Action.platform takes place of Command.platform if it is set
+func (s *ExecutorServer) actionPlatform(ctx context.Context, action *repb.Action) (*repb.Platform, error) {
+	if action.GetPlatform() != nil {
+		return action.GetPlatform(), nil
+	}
+	command, err := s.getCommandFromDigest(ctx, action.GetCommandDigest())
+	if err != nil {
+		return nil, err
+	}
+	return requiredPlatform(action, command), nil
 }
 
-func (s *ExecutorServer) WaitExecution(req *repb.WaitExecutionRequest, server repb.Execution_WaitExecutionServer) error {
-	return s.waitExecution(req, server, waitOpts{false})
+// requiredPlatform is actionPlatform with the command of action already fetched
+func requiredPlatform(action *repb.Action, command *repb.Command) *repb.Platform {
+	if action.GetPlatform() != nil {
+		return action.GetPlatform()
+	}
+	return command.GetPlatform()
 }
 
-func (s *ExecutorServer) getDirectoryFromDigest(ctx context.Context, d *repb.Digest) (*repb.Directory, error) {
-	logrus.Tracef("invoke getDirectoryFromDigest with %s", d.GetHash())
+func (s *ExecutorServer) getCommandFromDigest(ctx context.Context, d *repb.Digest) (*repb.Command, error) {
+	logrus.Tracef("invoke GetCommandFromDigest with %#v", d)
 	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, "")
 	if err != nil {
 		return nil, err
 	}
 	data, err := casCache.Get(ctx, d)
 	if err != nil {
-		return nil, err
+		return nil, notFoundAsMissing(err, d)
 	}
-	out := &repb.Directory{}
+	out := &repb.Command{}
 	if err := proto.Unmarshal(data, out); err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (s *ExecutorServer) ensureFiles(ctx context.Context, rootDigest *repb.Digest, base string) error {
-	rootDir, err := s.getDirectoryFromDigest(ctx, rootDigest)
-	if err != nil {
-		logrus.WithError(err).Errorf("GetDirectoryFromDigest with digest %s", rootDigest.GetHash())
-		return err
-	}
-	if rootDir.GetFiles() == nil && rootDir.GetNodeProperties() == nil && rootDir.GetDirectories() == nil && rootDir.GetSymlinks() == nil {
-		return nil
+// newActionDir creates a fresh directory under work_dir for an action
+func (s *ExecutorServer) newActionDir() (string, error) {
+	if err := os.MkdirAll(s.workDir, os.ModePerm); err != nil {
+		return "", err
 	}
-	if err := s.writeFiles(ctx, rootDir.GetFiles(), base); err != nil {
-		return err
+	return ioutil.TempDir(s.workDir, "action-")
+}
+
+func (s *ExecutorServer) removeActionDir(dir string) {
+	if s.keepActionDirs {
+		logrus.Debugf("keep action dir %s", dir)
+		return
 	}
-	for _, dir := range rootDir.GetDirectories() {
-		if err := s.ensureFiles(ctx, dir.GetDigest(), filepath.Join(base, dir.GetName())); err != nil {
-			return err
+	if err := os.RemoveAll(dir); err != nil {
+		// directories made read-only by the action or input node properties can not be removed
+		_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() {
+				_ = os.Chmod(path, 0755)
+			}
+			return nil
+		})
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.WithError(err).Warnf("remove action dir %s", dir)
 		}
 	}
-	return nil
 }
 
-func (s *ExecutorServer) writeFiles(ctx context.Context, files []*repb.FileNode, base string) error {
-	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, "")
-	if err != nil {
-		return err
+// commandDir returns the directory to run the command in, Command.working_directory
+// is relative to the input root and must not escape it.
+func commandDir(root string, command *repb.Command) (string, error) {
+	wd := filepath.Clean(command.GetWorkingDirectory())
+	if filepath.IsAbs(wd) || wd == ".." || strings.HasPrefix(wd, "../") {
+		return "", status.InvalidArgumentErrorf("working directory %q is not under the input root", command.GetWorkingDirectory())
 	}
-	for _, file := range files {
-		fn := filepath.Join(base, file.GetName())
-		if _, err := os.Stat(fn); err != nil && !os.IsNotExist(err) {
-			return err
-		} else if err == nil {
-			continue
-		}
+	return filepath.Join(root, wd), nil
+}
 
-		if err := os.MkdirAll(filepath.Dir(fn), os.ModePerm); err != nil {
-			return err
-		}
-		mode := os.FileMode(0644)
-		if file.GetIsExecutable() {
-			mode = os.FileMode(0555)
-		}
-		fi, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE, mode)
+// admitAndRunLocally keeps the operation queued until CPU slots and memory requested by the action are available
+func (s *ExecutorServer) admitAndRunLocally(ctx context.Context, op *operation, action *repb.Action, required *repb.Platform) (*repb.ActionResult, error) {
+	if s.admission != nil {
+		r, err := s.admission.Request(required)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		d := file.GetDigest()
-		// Get file contents
-		if d.GetHash() != EmptySha {
-			r, err := casCache.Reader(ctx, d, 0)
-			if err != nil {
-				logrus.WithError(err).Error("writeFiles")
-				return err
-			}
-			io.Copy(fi, r)
-			r.Close()
+		release, err := s.admission.Acquire(ctx, r)
+		if err != nil {
+			return nil, err
 		}
-		fi.Close()
+		defer release()
 	}
-	return nil
+	op.update(repb.ExecutionStage_EXECUTING, nil)
+	return s.runLocally(ctx, op, action)
 }
 
-func (s *ExecutorServer) getCommandFromDigest(ctx context.Context, d *repb.Digest) (*repb.Command, error) {
-	logrus.Tracef("invoke GetCommandFromDigest with %#v", d)
-	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, "")
+// runLocally runs the action of operation by this server, outputs of the command can be read from log streams of op
+func (s *ExecutorServer) runLocally(ctx context.Context, op *operation, action *repb.Action) (*repb.ActionResult, error) {
+	if op.stdoutStream == "" {
+		return s.runWorker(ctx, action, nil, nil)
+	}
+	stdout, _ := s.logStreams.get(op.stdoutStream)
+	stderr, _ := s.logStreams.get(op.stderrStream)
+	return s.runWorker(ctx, action, stdout, stderr)
+}
+
+// runWorker runs the action in a new directory, outputs of the command are also written to stdout and stderr if they are not nil
+func (s *ExecutorServer) runWorker(ctx context.Context, action *repb.Action, stdout, stderr io.Writer) (*repb.ActionResult, error) {
+	// QueuedTimestamp is set by the operation, which knows when the action was queued
+	md := &repb.ExecutedActionMetadata{Worker: s.worker, WorkerStartTimestamp: timestamppb.Now()}
+	actionDir, err := s.newActionDir()
 	if err != nil {
+		logrus.WithError(err).Errorf("newActionDir")
 		return nil, err
 	}
-	data, err := casCache.Get(ctx, d)
+	defer s.removeActionDir(actionDir)
+
+	md.InputFetchStartTimestamp = timestamppb.Now()
+	// all missing inputs are reported at once, so that clients upload them before executing the action again
+	missing, err := s.findMissingInputs(ctx, action)
 	if err != nil {
 		return nil, err
 	}
-	out := &repb.Command{}
-	if err := proto.Unmarshal(data, out); err != nil {
-		return nil, err
+	if len(missing) > 0 {
+		return nil, missingBlobsError(missing...)
 	}
-	return out, nil
-}
-
-func (s *ExecutorServer) runWorker(ctx context.Context, action *repb.Action, workdir string) (*repb.ActionResult, error) {
-	if err := s.ensureFiles(ctx, action.GetInputRootDigest(), workdir); err != nil {
+	if err := s.ensureFiles(ctx, action.GetInputRootDigest(), actionDir); err != nil {
 		logrus.WithError(err).Errorf("ensureFiles")
 		return nil, err
 	}
+	md.InputFetchCompletedTimestamp = timestamppb.Now()
 
 	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, "")
 	if err != nil {
@@ -410,7 +559,7 @@ func (s *ExecutorServer) runWorker(ctx context.Context, action *repb.Action, wor
 	for _, env := range command.GetEnvironmentVariables() {
 		envStr += fmt.Sprintf("%s=%s ", env.Name, env.Value)
 	}
-	logrus.Debugln("platform: ", command.GetPlatform())
+	logrus.Debugln("platform: ", requiredPlatform(action, command))
 	logrus.Debugln("arguments: ", command.GetArguments())
 	logrus.Debugln("environmentVariables: ", envStr)
 	logrus.Debugln("outputDirectories: ", command.GetOutputDirectories())
@@ -419,18 +568,43 @@ func (s *ExecutorServer) runWorker(ctx context.Context, action *repb.Action, wor
 	logrus.Debugln("outputPaths: ", command.GetOutputPaths())
 	logrus.Debugln("workingDirectory: ", command.GetWorkingDirectory())
 
-	// mkdir all GetOutputFiles's dir
-	for _, file := range command.GetOutputFiles() {
-		base := filepath.Join(workdir, filepath.Dir(file))
-		if err := os.MkdirAll(base, os.ModePerm); err != nil {
-			logrus.WithError(err).Errorf("os.MkdirAll")
-			return nil, err
+	// output paths are relative to the working directory
+	workdir, err := commandDir(actionDir, command)
+	if err != nil {
+		return nil, err
+	}
+	if err := mkdirUnder(actionDir, command.GetWorkingDirectory()); err != nil {
+		return nil, err
+	}
+
+	if err := prepareOutputs(workdir, command); err != nil {
+		logrus.WithError(err).Errorf("prepareOutputs")
+		return nil, err
+	}
+
+	timeout, err := s.actionTimeout(action)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := s.runners.Get(requiredPlatform(action, command))
+	if err != nil {
+		return nil, err
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	md.ExecutionStartTimestamp = timestamppb.Now()
+	result := runner.Run(cmdCtx, command, actionDir, workdir, stdout, stderr)
+	md.ExecutionCompletedTimestamp = timestamppb.Now()
+	logrus.Debugf("run command result: (exit_code: %d, stderr: %s, stdout: %s, err: %s)", result.ExitCode, result.Stderr, result.Stdout, result.Error)
+	if result.UsageStats != nil {
+		usage, err := anypb.New(result.UsageStats)
+		if err != nil {
+			return nil, status.InternalErrorf("marshal usage stats error: %s", err)
 		}
+		md.AuxiliaryMetadata = append(md.AuxiliaryMetadata, usage)
 	}
 
-	var stdout bytes.Buffer
-	result := commandutil.Run(ctx, command, s.workDir, &bytes.Buffer{}, &stdout)
-	logrus.Debugf("commandutil.Run result: (exit_code: %d, stderr: %s, stdout: %s, err: %s)", result.ExitCode, result.Stderr, result.Stdout, result.Error)
+	md.OutputUploadStartTimestamp = timestamppb.Now()
 
 	stdoutDigest := utils.CalSHA256OfInput(result.Stdout)
 	stderrDigest := utils.CalSHA256OfInput(result.Stderr)
@@ -442,54 +616,40 @@ func (s *ExecutorServer) runWorker(ctx context.Context, action *repb.Action, wor
 		casCache.Set(ctx, stderrDigest, result.Stderr)
 	}
 
-	var outputFiles []*repb.OutputFile
-	for _, path := range command.GetOutputFiles() {
-		fn := filepath.Join(workdir, path)
-		fstat, err := os.Stat(fn)
-		if err != nil {
-			return nil, err
-		}
-		if fstat.IsDir() {
-			return nil, fmt.Errorf("%s is a dir", fn)
-		}
-		b, err := ioutil.ReadFile(fn)
-		if err != nil {
-			logrus.WithError(err).Errorf("ioutil.ReadFile")
-			return nil, err
-		}
-		sum := sha256.Sum256(b)
-		hash := hex.EncodeToString(sum[:])
-		d := &repb.Digest{
-			Hash:      hash,
-			SizeBytes: fstat.Size(),
+	if result.Error != nil {
+		if status.IsDeadlineExceededError(result.Error) {
+			// return the partial stdout and stderr of timed out action
+			md.OutputUploadCompletedTimestamp = timestamppb.Now()
+			md.WorkerCompletedTimestamp = md.OutputUploadCompletedTimestamp
+			return &repb.ActionResult{
+				ExitCode:          int32(result.ExitCode),
+				StdoutDigest:      stdoutDigest,
+				StderrDigest:      stderrDigest,
+				ExecutionMetadata: md,
+			}, result.Error
 		}
-		if !action.GetDoNotCache() {
-			if err := casCache.Set(ctx, d, b); err != nil {
-				return nil, err
-			}
-		}
-		outputFiles = append(outputFiles, &repb.OutputFile{
-			Path:           path,
-			Digest:         d,
-			IsExecutable:   fstat.Mode()&0555 != 0,
-			NodeProperties: nil,
-		})
+		return nil, result.Error
 	}
-	return &repb.ActionResult{
-		OutputFiles:             outputFiles,
-		OutputFileSymlinks:      nil,
-		OutputSymlinks:          nil,
-		OutputDirectories:       nil,
-		OutputDirectorySymlinks: nil,
-		ExitCode:                int32(result.ExitCode),
-		StdoutRaw:               result.Stdout,
-		StdoutDigest:            stdoutDigest,
-		StderrRaw:               result.Stderr,
-		StderrDigest:            stderrDigest,
-		ExecutionMetadata: &repb.ExecutedActionMetadata{
-			Worker:               "main",
-			QueuedTimestamp:      timestamppb.Now(),
-			WorkerStartTimestamp: timestamppb.Now(),
-		},
-	}, nil
+
+	ar := &repb.ActionResult{
+		ExitCode:          int32(result.ExitCode),
+		StdoutRaw:         result.Stdout,
+		StdoutDigest:      stdoutDigest,
+		StderrRaw:         result.Stderr,
+		StderrDigest:      stderrDigest,
+		ExecutionMetadata: md,
+	}
+	collector := &outputCollector{
+		ctx:             ctx,
+		cas:             casCache,
+		workdir:         workdir,
+		symlinkStrategy: symlinkAbsolutePathStrategy,
+	}
+	if err := collector.collect(command, ar); err != nil {
+		logrus.WithError(err).Errorf("collect outputs")
+		return nil, err
+	}
+	md.OutputUploadCompletedTimestamp = timestamppb.Now()
+	md.WorkerCompletedTimestamp = md.OutputUploadCompletedTimestamp
+	return ar, nil
 }
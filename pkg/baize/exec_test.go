@@ -0,0 +1,450 @@
+package baize
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/protobuf/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	nstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/dashjay/baize/pkg/admission"
+	"github.com/dashjay/baize/pkg/caches"
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/interfaces"
+	schedulerpb "github.com/dashjay/baize/pkg/proto/scheduler"
+	usagepb "github.com/dashjay/baize/pkg/proto/usage"
+	"github.com/dashjay/baize/pkg/scheduler"
+	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/digest"
+	"github.com/dashjay/baize/pkg/utils/platform"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+type fakeWriteJobLogServer struct {
+	grpc.ServerStream
+	reqs []*schedulerpb.WriteJobLogReq
+}
+
+func (f *fakeWriteJobLogServer) Recv() (*schedulerpb.WriteJobLogReq, error) {
+	if len(f.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := f.reqs[0]
+	f.reqs = f.reqs[1:]
+	return req, nil
+}
+
+func (f *fakeWriteJobLogServer) SendAndClose(*schedulerpb.WriteJobLogResp) error {
+	return nil
+}
+
+var _ = Describe("test action timeout", func() {
+	s := &ExecutorServer{defaultActionTimeout: time.Minute, maxActionTimeout: time.Hour}
+	It("use default timeout if not set", func() {
+		timeout, err := s.actionTimeout(&repb.Action{})
+		Expect(err).To(BeNil())
+		Expect(timeout).To(Equal(time.Minute))
+	})
+	It("use timeout of action", func() {
+		timeout, err := s.actionTimeout(&repb.Action{Timeout: durationpb.New(10 * time.Second)})
+		Expect(err).To(BeNil())
+		Expect(timeout).To(Equal(10 * time.Second))
+	})
+	It("reject timeout longer than max", func() {
+		_, err := s.actionTimeout(&repb.Action{Timeout: durationpb.New(2 * time.Hour)})
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("test command dir", func() {
+	It("run command in working directory under root", func() {
+		dir, err := commandDir("/work/action-1", &repb.Command{WorkingDirectory: "pkg/sub"})
+		Expect(err).To(BeNil())
+		Expect(dir).To(Equal("/work/action-1/pkg/sub"))
+		dir, err = commandDir("/work/action-1", &repb.Command{})
+		Expect(err).To(BeNil())
+		Expect(dir).To(Equal("/work/action-1"))
+	})
+	It("reject working directory escaping root", func() {
+		_, err := commandDir("/work/action-1", &repb.Command{WorkingDirectory: "../action-2"})
+		Expect(err).NotTo(BeNil())
+		_, err = commandDir("/work/action-1", &repb.Command{WorkingDirectory: "/tmp"})
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("test ensure files", func() {
+	var (
+		ctx  = context.Background()
+		s    *ExecutorServer
+		cas  interfaces.Cache
+		root string
+	)
+	put := func(data []byte) *repb.Digest {
+		d := utils.CalSHA256OfInput(data)
+		Expect(cas.Set(ctx, d, data)).To(BeNil())
+		return d
+	}
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "ensure-files-test-")
+		Expect(err).To(BeNil())
+		s = newTestServer("")
+		cas = casOf(s)
+	})
+	AfterEach(func() {
+		s.removeActionDir(root)
+		_, err := os.Stat(root)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+	It("materialize symlinks and node properties", func() {
+		mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		sub := putProto(cas, &repb.Directory{
+			Files: []*repb.FileNode{{
+				Name:   "tool.sh",
+				Digest: put([]byte("#!/bin/sh\n")),
+				NodeProperties: &repb.NodeProperties{
+					Mtime:    timestamppb.New(mtime),
+					UnixMode: wrapperspb.UInt32(0750),
+				},
+			}},
+			Symlinks:       []*repb.SymlinkNode{{Name: "link", Target: "tool.sh"}},
+			NodeProperties: &repb.NodeProperties{Mtime: timestamppb.New(mtime), UnixMode: wrapperspb.UInt32(0555)},
+		})
+		rootDigest := putProto(cas, &repb.Directory{Directories: []*repb.DirectoryNode{{Name: "bin", Digest: sub}}})
+		Expect(s.ensureFiles(ctx, rootDigest, root)).To(BeNil())
+
+		info, err := os.Stat(filepath.Join(root, "bin/tool.sh"))
+		Expect(err).To(BeNil())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+		Expect(info.ModTime().Equal(mtime)).To(BeTrue())
+		target, err := os.Readlink(filepath.Join(root, "bin/link"))
+		Expect(err).To(BeNil())
+		Expect(target).To(Equal("tool.sh"))
+		info, err = os.Stat(filepath.Join(root, "bin"))
+		Expect(err).To(BeNil())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0555)))
+		Expect(info.ModTime().Equal(mtime)).To(BeTrue())
+
+		caps, err := s.GetCapabilities(ctx, &repb.GetCapabilitiesRequest{})
+		Expect(err).To(BeNil())
+		Expect(caps.GetExecutionCapabilities().GetSupportedNodeProperties()).To(ConsistOf("mtime", "unix_mode"))
+	})
+	It("resolve deep tree and memoize directories", func() {
+		content := put([]byte("content"))
+		dir := &repb.Directory{Files: []*repb.FileNode{{Name: "a", Digest: content}, {Name: "b", Digest: content}}}
+		for i := 0; i < 5; i++ {
+			d := putProto(cas, dir)
+			dir = &repb.Directory{
+				Files:       []*repb.FileNode{{Name: "f", Digest: content}},
+				Directories: []*repb.DirectoryNode{{Name: "x", Digest: d}, {Name: "y", Digest: d}},
+			}
+		}
+		rootDigest := putProto(cas, dir)
+		Expect(s.ensureFiles(ctx, rootDigest, root)).To(BeNil())
+		data, err := ioutil.ReadFile(filepath.Join(root, "x/y/x/y/x/b"))
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal("content"))
+
+		// directories are memoized, removing them from CAS does no harm
+		Expect(cas.Delete(ctx, rootDigest)).To(BeNil())
+		Expect(s.ensureFiles(ctx, rootDigest, filepath.Join(root, "again"))).To(BeNil())
+		_, err = os.Stat(filepath.Join(root, "again/y/x/y/x/y/a"))
+		Expect(err).To(BeNil())
+	})
+	It("reject names escaping the input root", func() {
+		rootDigest := putProto(cas, &repb.Directory{Files: []*repb.FileNode{{Name: "../escape", Digest: put([]byte("x"))}}})
+		Expect(s.ensureFiles(ctx, rootDigest, root)).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("test link input files", func() {
+	var (
+		ctx      = context.Background()
+		s        *ExecutorServer
+		cas      interfaces.Cache
+		cacheDir string
+		root     string
+	)
+	BeforeEach(func() {
+		var err error
+		cacheDir, err = ioutil.TempDir("", "link-inputs-cache-")
+		Expect(err).To(BeNil())
+		root, err = ioutil.TempDir("", "link-inputs-test-")
+		Expect(err).To(BeNil())
+		s = newTestServer("")
+		s.cache = caches.NewDiskCache(&config.Cache{Enabled: true, CacheSize: 1 << 20, CacheAddr: cacheDir})
+		s.linkInputs = true
+		cas = casOf(s)
+	})
+	AfterEach(func() {
+		s.removeActionDir(root)
+		Expect(os.RemoveAll(cacheDir)).To(BeNil())
+	})
+	It("hardlink plain files and copy executables", func() {
+		content := []byte("content")
+		d := utils.CalSHA256OfInput(content)
+		Expect(cas.Set(ctx, d, content)).To(BeNil())
+		dir, err := proto.Marshal(&repb.Directory{Files: []*repb.FileNode{
+			{Name: "plain", Digest: d},
+			{Name: "exec", Digest: d, IsExecutable: true},
+		}})
+		Expect(err).To(BeNil())
+		rootDigest := utils.CalSHA256OfInput(dir)
+		Expect(cas.Set(ctx, rootDigest, dir)).To(BeNil())
+		Expect(s.ensureFiles(ctx, rootDigest, root)).To(BeNil())
+
+		src, release, err := cas.(interfaces.LocalFileCache).Acquire(ctx, d)
+		Expect(err).To(BeNil())
+		defer release()
+		srcInfo, err := os.Stat(src)
+		Expect(err).To(BeNil())
+		plain, err := os.Stat(filepath.Join(root, "plain"))
+		Expect(err).To(BeNil())
+		Expect(os.SameFile(srcInfo, plain)).To(BeTrue())
+		Expect(plain.Mode().Perm()).To(Equal(os.FileMode(0444)))
+		exec, err := os.Stat(filepath.Join(root, "exec"))
+		Expect(err).To(BeNil())
+		Expect(os.SameFile(srcInfo, exec)).To(BeFalse())
+		Expect(exec.Mode().Perm()).To(Equal(os.FileMode(0555)))
+		data, err := ioutil.ReadFile(filepath.Join(root, "exec"))
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(content))
+	})
+	It("never link blobs rewritten through hardlinked inputs", func() {
+		content := []byte("content")
+		d := utils.CalSHA256OfInput(content)
+		Expect(cas.Set(ctx, d, content)).To(BeNil())
+		dir, err := proto.Marshal(&repb.Directory{Files: []*repb.FileNode{{Name: "plain", Digest: d}}})
+		Expect(err).To(BeNil())
+		rootDigest := utils.CalSHA256OfInput(dir)
+		Expect(cas.Set(ctx, rootDigest, dir)).To(BeNil())
+		Expect(s.ensureFiles(ctx, rootDigest, root)).To(BeNil())
+
+		// the action runs as the same user, so it can make the input writable and rewrite the cache
+		plain := filepath.Join(root, "plain")
+		Expect(os.Chmod(plain, 0644)).To(BeNil())
+		Expect(ioutil.WriteFile(plain, []byte("corrupted"), 0644)).To(BeNil())
+
+		another := filepath.Join(root, "another")
+		Expect(os.Mkdir(another, os.ModePerm)).To(BeNil())
+		err = s.ensureFiles(ctx, rootDigest, another)
+		Expect(missingSubjects(err)).To(Equal([]string{fmt.Sprintf("blobs/%s/%d", d.GetHash(), d.GetSizeBytes())}))
+		exists, err := cas.Contains(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeFalse())
+
+		// the blob uploaded again is linked
+		Expect(cas.Set(ctx, d, content)).To(BeNil())
+		Expect(s.ensureFiles(ctx, rootDigest, another)).To(BeNil())
+		data, err := ioutil.ReadFile(filepath.Join(another, "plain"))
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(content))
+	})
+	It("never apply node properties to the inode of the cache", func() {
+		content := []byte("content")
+		d := utils.CalSHA256OfInput(content)
+		Expect(cas.Set(ctx, d, content)).To(BeNil())
+		mtime := time.Unix(1000000000, 0)
+		dir, err := proto.Marshal(&repb.Directory{Files: []*repb.FileNode{{
+			Name:           "plain",
+			Digest:         d,
+			NodeProperties: &repb.NodeProperties{Mtime: timestamppb.New(mtime), UnixMode: wrapperspb.UInt32(0600)},
+		}}})
+		Expect(err).To(BeNil())
+		rootDigest := utils.CalSHA256OfInput(dir)
+		Expect(cas.Set(ctx, rootDigest, dir)).To(BeNil())
+		Expect(s.ensureFiles(ctx, rootDigest, root)).To(BeNil())
+
+		plain, err := os.Stat(filepath.Join(root, "plain"))
+		Expect(err).To(BeNil())
+		Expect(plain.ModTime().Equal(mtime)).To(BeTrue())
+		Expect(plain.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		src, release, err := cas.(interfaces.LocalFileCache).Acquire(ctx, d)
+		Expect(err).To(BeNil())
+		defer release()
+		srcInfo, err := os.Stat(src)
+		Expect(err).To(BeNil())
+		Expect(os.SameFile(srcInfo, plain)).To(BeFalse())
+		Expect(srcInfo.ModTime().Equal(mtime)).To(BeFalse())
+		Expect(srcInfo.Mode().Perm()).NotTo(Equal(os.FileMode(0600)))
+	})
+	It("copy files unless link_inputs is set", func() {
+		s.linkInputs = false
+		content := []byte("content")
+		d := utils.CalSHA256OfInput(content)
+		Expect(cas.Set(ctx, d, content)).To(BeNil())
+		dir, err := proto.Marshal(&repb.Directory{Files: []*repb.FileNode{{Name: "plain", Digest: d}}})
+		Expect(err).To(BeNil())
+		rootDigest := utils.CalSHA256OfInput(dir)
+		Expect(cas.Set(ctx, rootDigest, dir)).To(BeNil())
+		Expect(s.ensureFiles(ctx, rootDigest, root)).To(BeNil())
+		plain, err := os.Stat(filepath.Join(root, "plain"))
+		Expect(err).To(BeNil())
+		Expect(plain.Sys().(*syscall.Stat_t).Nlink).To(Equal(uint64(1)))
+	})
+})
+
+var _ = Describe("test execution metadata", func() {
+	var (
+		ctx     = context.Background()
+		s       *ExecutorServer
+		cas     interfaces.Cache
+		workDir string
+	)
+	BeforeEach(func() {
+		var err error
+		workDir, err = ioutil.TempDir("", "execution-metadata-test-")
+		Expect(err).To(BeNil())
+		s = newTestServer(workDir)
+		s.worker = "worker-1"
+		cas = casOf(s)
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(workDir)).To(BeNil())
+	})
+	It("record timestamps of every phase and usage of the command", func() {
+		action := &repb.Action{
+			CommandDigest:   putProto(cas, &repb.Command{Arguments: []string{"sh", "-c", "echo hello > out"}, OutputFiles: []string{"out"}}),
+			InputRootDigest: putProto(cas, &repb.Directory{}),
+		}
+		ar, err := s.runWorker(ctx, action, nil, nil)
+		Expect(err).To(BeNil())
+		md := ar.GetExecutionMetadata()
+		Expect(md.GetWorker()).To(Equal("worker-1"))
+		timestamps := []*timestamppb.Timestamp{
+			md.GetWorkerStartTimestamp(),
+			md.GetInputFetchStartTimestamp(),
+			md.GetInputFetchCompletedTimestamp(),
+			md.GetExecutionStartTimestamp(),
+			md.GetExecutionCompletedTimestamp(),
+			md.GetOutputUploadStartTimestamp(),
+			md.GetOutputUploadCompletedTimestamp(),
+			md.GetWorkerCompletedTimestamp(),
+		}
+		for i, ts := range timestamps {
+			Expect(ts).NotTo(BeNil())
+			if i > 0 {
+				Expect(ts.AsTime().Before(timestamps[i-1].AsTime())).To(BeFalse())
+			}
+		}
+		Expect(md.GetAuxiliaryMetadata()).To(HaveLen(1))
+		stats := &usagepb.UsageStats{}
+		Expect(md.GetAuxiliaryMetadata()[0].UnmarshalTo(stats)).To(BeNil())
+		Expect(stats.GetPeakMemoryBytes()).To(BeNumerically(">", 0))
+		Expect(stats.GetUserCpuTime()).NotTo(BeNil())
+	})
+	It("keep operation queued until resources requested are available", func() {
+		s.admission = admission.New(admission.Request{CPUs: 2, MemoryBytes: 1 << 30}, 0)
+		action := &repb.Action{
+			CommandDigest:   putProto(cas, &repb.Command{Arguments: []string{"true"}}),
+			InputRootDigest: putProto(cas, &repb.Directory{}),
+		}
+		release, err := s.admission.Acquire(ctx, admission.Request{CPUs: 1})
+		Expect(err).To(BeNil())
+		op := newOperation("op-1", nil, func() {})
+		required := &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.CPU, Value: "2"}}}
+		done := make(chan error)
+		go func() {
+			_, err := s.admitAndRunLocally(ctx, op, action, required)
+			done <- err
+		}()
+		Consistently(func() repb.ExecutionStage_Value {
+			stage, _, _ := op.snapshot()
+			return stage
+		}, 100*time.Millisecond).Should(Equal(repb.ExecutionStage_QUEUED))
+		release()
+		Eventually(done).Should(Receive(BeNil()))
+
+		required.Properties[0].Value = "4"
+		_, err = s.admitAndRunLocally(ctx, op, action, required)
+		Expect(status.IsFailedPreconditionError(err)).To(BeTrue())
+		required.Properties[0].Value = "two"
+		_, err = s.admitAndRunLocally(ctx, op, action, required)
+		Expect(status.IsInvalidArgumentError(err)).To(BeTrue())
+	})
+	It("serve outputs forwarded by executors by log streams", func() {
+		s.scheduler = scheduler.NewScheduler(&config.ServerConfig{})
+		defer s.scheduler.Stop()
+		s.operations = newOperationStore()
+		s.logStreams = newLogStreamStore()
+		_, err := s.scheduler.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: "executor", ExecutorInfo: &schedulerpb.Property{}})
+		Expect(err).To(BeNil())
+		action := &repb.Action{
+			CommandDigest:   putProto(cas, &repb.Command{Arguments: []string{"true"}}),
+			InputRootDigest: putProto(cas, &repb.Directory{}),
+		}
+		r := digest.NewResourceName(putProto(cas, action), "")
+		name, err := r.UploadString()
+		Expect(err).To(BeNil())
+		op := s.startOperation(name, r, action, nil, 0)
+		longrunning, err := op.toProto()
+		Expect(err).To(BeNil())
+		eom := &repb.ExecuteOperationMetadata{}
+		Expect(longrunning.GetMetadata().UnmarshalTo(eom)).To(BeNil())
+		Expect(eom.GetStdoutStreamName()).NotTo(BeEmpty())
+		Expect(eom.GetStderrStreamName()).NotTo(BeEmpty())
+
+		job, err := s.scheduler.GetJob(ctx, &schedulerpb.GetJobReq{ExecutorId: "executor"})
+		Expect(err).To(BeNil())
+		Expect(job.GetJobId()).To(Equal(name))
+		Expect(s.scheduler.WriteJobLog(&fakeWriteJobLogServer{reqs: []*schedulerpb.WriteJobLogReq{
+			{ExecutorId: "executor", JobId: name, Data: []byte("hello")},
+			{ExecutorId: "executor", JobId: name, Stderr: true, Data: []byte("oops")},
+		}})).To(BeNil())
+		_, err = s.scheduler.FailJob(ctx, &schedulerpb.FailJobReq{ExecutorId: "executor", JobId: name, Status: &nstatus.Status{Code: int32(codes.InvalidArgument)}})
+		Expect(err).To(BeNil())
+		for stream, data := range map[string]string{eom.GetStdoutStreamName(): "hello", eom.GetStderrStreamName(): "oops"} {
+			l, exists := s.logStreams.get(stream)
+			Expect(exists).To(BeTrue())
+			Eventually(func() bool {
+				_, closed, _ := l.snapshot(0)
+				return closed
+			}).Should(BeTrue())
+			got, _, _ := l.snapshot(0)
+			Expect(string(got)).To(Equal(data))
+		}
+	})
+	It("finish log streams of operations rejected by admission", func() {
+		s.admission = admission.New(admission.Request{CPUs: 2, MemoryBytes: 1 << 30}, 0)
+		s.operations = newOperationStore()
+		s.logStreams = newLogStreamStore()
+		action := &repb.Action{
+			CommandDigest:   putProto(cas, &repb.Command{Arguments: []string{"true"}}),
+			InputRootDigest: putProto(cas, &repb.Directory{}),
+		}
+		r := digest.NewResourceName(putProto(cas, action), "")
+		name, err := r.UploadString()
+		Expect(err).To(BeNil())
+		required := &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.CPU, Value: "4"}}}
+		op := s.startOperation(name, r, action, required, 0)
+		Eventually(func() repb.ExecutionStage_Value {
+			stage, _, _ := op.snapshot()
+			return stage
+		}).Should(Equal(repb.ExecutionStage_COMPLETED))
+		_, rsp, _ := op.snapshot()
+		Expect(rsp.GetStatus().GetCode()).To(Equal(int32(codes.FailedPrecondition)))
+		for _, name := range []string{op.stdoutStream, op.stderrStream} {
+			l, exists := s.logStreams.get(name)
+			Expect(exists).To(BeTrue())
+			Eventually(func() bool {
+				_, closed, _ := l.snapshot(0)
+				return closed
+			}).Should(BeTrue())
+		}
+	})
+})
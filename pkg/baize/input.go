@@ -0,0 +1,502 @@
+package baize
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/dashjay/baize/pkg/copy_from_buildbuddy/utils/lru"
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+const (
+	defaultInputFetchConcurrency = 32
+	defaultDirectoryCacheSize    = 64 << 20
+	// defaultVerifiedBlobsSize is how many verified blobs of the local cache are remembered
+	defaultVerifiedBlobsSize = 1 << 20
+)
+
+// directoryCache memoizes parsed Directory protos across actions, most actions of
+// a build share the same toolchain and source directories.
+type directoryCache struct {
+	mu  sync.Mutex
+	lru interfaces.LRU
+}
+
+type directoryCacheEntry struct {
+	dir  *repb.Directory
+	size int64
+}
+
+func newDirectoryCache(maxSize int64) *directoryCache {
+	l, err := lru.NewLRU(&lru.Config{
+		MaxSize: maxSize,
+		SizeFn: func(value interface{}) int64 {
+			return value.(*directoryCacheEntry).size
+		},
+	})
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return &directoryCache{lru: l}
+}
+
+func directoryKey(d *repb.Digest) string {
+	return fmt.Sprintf("%s/%d", d.GetHash(), d.GetSizeBytes())
+}
+
+func (c *directoryCache) get(d *repb.Digest) (*repb.Directory, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, exists := c.lru.Get(directoryKey(d))
+	if !exists {
+		return nil, false
+	}
+	return v.(*directoryCacheEntry).dir, true
+}
+
+func (c *directoryCache) add(d *repb.Digest, dir *repb.Directory) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Add(directoryKey(d), &directoryCacheEntry{dir: dir, size: d.GetSizeBytes()})
+}
+
+// verifiedBlobs remembers files of the local cache whose content was verified against their digests.
+// Inputs hardlinked into exec roots share the inode with the cache, an action can make them writable and
+// rewrite them, so a file is hashed again once its inode, size or mtime changed since it was verified.
+type verifiedBlobs struct {
+	mu  sync.Mutex
+	lru interfaces.LRU
+}
+
+type blobStamp struct {
+	ino   uint64
+	size  int64
+	mtime int64
+}
+
+func newVerifiedBlobs(maxEntries int64) *verifiedBlobs {
+	l, err := lru.NewLRU(&lru.Config{
+		MaxSize: maxEntries,
+		SizeFn: func(value interface{}) int64 {
+			return 1
+		},
+	})
+	if err != nil {
+		logrus.Panic(err)
+	}
+	return &verifiedBlobs{lru: l}
+}
+
+func stampOf(fn string) (blobStamp, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(fn, &st); err != nil {
+		return blobStamp{}, err
+	}
+	return blobStamp{ino: st.Ino, size: st.Size, mtime: st.Mtim.Nano()}, nil
+}
+
+// verify reports whether file fn of the local cache still has the content of d
+func (v *verifiedBlobs) verify(fn string, d *repb.Digest) (bool, error) {
+	stamp, err := stampOf(fn)
+	if err != nil {
+		return false, err
+	}
+	v.mu.Lock()
+	verified, exists := v.lru.Get(fn)
+	v.mu.Unlock()
+	if exists && verified.(blobStamp) == stamp {
+		return true, nil
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	actual, err := utils.CalSHA256FromReader(f)
+	if err != nil {
+		return false, err
+	}
+	if actual.GetHash() != d.GetHash() || actual.GetSizeBytes() != d.GetSizeBytes() {
+		return false, nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.lru.Add(fn, stamp)
+	return true, nil
+}
+
+// getDirectories returns Directory protos of digests in the same order, the ones not
+// memoized are fetched by one GetMulti.
+func (s *ExecutorServer) getDirectories(ctx context.Context, casCache interfaces.Cache, digests []*repb.Digest) ([]*repb.Directory, error) {
+	out := make([]*repb.Directory, len(digests))
+	missing := make(map[string]*repb.Digest)
+	var toFetch []*repb.Digest
+	for i, d := range digests {
+		// empty blobs are never stored
+		if d.GetHash() == EmptySha {
+			out[i] = &repb.Directory{}
+			continue
+		}
+		if dir, exists := s.directories.get(d); exists {
+			out[i] = dir
+			continue
+		}
+		if _, exists := missing[directoryKey(d)]; !exists {
+			missing[directoryKey(d)] = d
+			toFetch = append(toFetch, d)
+		}
+	}
+	if len(toFetch) == 0 {
+		return out, nil
+	}
+	logrus.Tracef("fetch %d directories", len(toFetch))
+	blobs, err := casCache.GetMulti(ctx, toFetch)
+	if status.IsNotFoundError(err) {
+		if missingDigests, findErr := casCache.FindMissing(ctx, toFetch); findErr == nil && len(missingDigests) > 0 {
+			return nil, missingBlobsError(missingDigests...)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	fetched := make(map[string]*repb.Directory, len(toFetch))
+	for _, d := range toFetch {
+		dir := &repb.Directory{}
+		if err := proto.Unmarshal(blobs[d], dir); err != nil {
+			return nil, status.InvalidArgumentErrorf("unmarshal directory %s error: %s", d.GetHash(), err)
+		}
+		s.directories.add(d, dir)
+		fetched[directoryKey(d)] = dir
+	}
+	for i, d := range digests {
+		if out[i] == nil {
+			out[i] = fetched[directoryKey(d)]
+		}
+	}
+	return out, nil
+}
+
+// inputDir is a directory of the input tree and the path it is materialized at
+type inputDir struct {
+	path string
+	dir  *repb.Directory
+}
+
+// validName checks name of node in Directory, which must be a single path component
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return status.InvalidArgumentErrorf("invalid name %q in input tree", name)
+	}
+	return nil
+}
+
+// findMissingInputs walks the input tree of action once and returns the command, directories and files of it
+// missing in CAS, subtrees of missing directories are skipped.
+func (s *ExecutorServer) findMissingInputs(ctx context.Context, action *repb.Action) ([]*repb.Digest, error) {
+	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, "")
+	if err != nil {
+		return nil, err
+	}
+	var missing []*repb.Digest
+	blobs := []*repb.Digest{action.GetCommandDigest()}
+	seenBlobs := map[string]bool{directoryKey(action.GetCommandDigest()): true}
+	seenDirs := make(map[string]bool)
+	level := []*repb.Digest{action.GetInputRootDigest()}
+	for len(level) > 0 {
+		var stored []*repb.Digest
+		for _, d := range level {
+			if d.GetHash() != EmptySha {
+				stored = append(stored, d)
+			}
+		}
+		var absent []*repb.Digest
+		if len(stored) > 0 {
+			if absent, err = casCache.FindMissing(ctx, stored); err != nil {
+				return nil, err
+			}
+		}
+		missing = append(missing, absent...)
+		absentKeys := make(map[string]bool, len(absent))
+		for _, d := range absent {
+			absentKeys[directoryKey(d)] = true
+		}
+		var present []*repb.Digest
+		for _, d := range level {
+			if !absentKeys[directoryKey(d)] {
+				present = append(present, d)
+			}
+		}
+		dirs, err := s.getDirectories(ctx, casCache, present)
+		if err != nil {
+			return nil, err
+		}
+		var next []*repb.Digest
+		for _, dir := range dirs {
+			for _, file := range dir.GetFiles() {
+				if key := directoryKey(file.GetDigest()); !seenBlobs[key] && file.GetDigest().GetHash() != EmptySha {
+					seenBlobs[key] = true
+					blobs = append(blobs, file.GetDigest())
+				}
+			}
+			for _, child := range dir.GetDirectories() {
+				if key := directoryKey(child.GetDigest()); !seenDirs[key] {
+					seenDirs[key] = true
+					next = append(next, child.GetDigest())
+				}
+			}
+		}
+		level = next
+	}
+	absent, err := casCache.FindMissing(ctx, blobs)
+	if err != nil {
+		return nil, err
+	}
+	return append(missing, absent...), nil
+}
+
+// ensureFiles materializes the input tree under base, the tree is resolved level by level
+// and files are downloaded with bounded concurrency.
+func (s *ExecutorServer) ensureFiles(ctx context.Context, rootDigest *repb.Digest, base string) error {
+	casCache, err := s.cache.WithIsolation(ctx, interfaces.CASCacheType, "")
+	if err != nil {
+		return err
+	}
+	var dirs []inputDir
+	paths, digests := []string{base}, []*repb.Digest{rootDigest}
+	for len(digests) > 0 {
+		level, err := s.getDirectories(ctx, casCache, digests)
+		if err != nil {
+			logrus.WithError(err).Errorf("get directories of input root %s", rootDigest.GetHash())
+			return err
+		}
+		var nextPaths []string
+		var nextDigests []*repb.Digest
+		for i, dir := range level {
+			if err := os.MkdirAll(paths[i], os.ModePerm); err != nil {
+				return err
+			}
+			dirs = append(dirs, inputDir{path: paths[i], dir: dir})
+			for _, child := range dir.GetDirectories() {
+				if err := validName(child.GetName()); err != nil {
+					return err
+				}
+				nextPaths = append(nextPaths, filepath.Join(paths[i], child.GetName()))
+				nextDigests = append(nextDigests, child.GetDigest())
+			}
+		}
+		paths, digests = nextPaths, nextDigests
+	}
+	if err := s.writeFiles(ctx, casCache, dirs); err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if err := writeSymlinks(d.dir.GetSymlinks(), d.path); err != nil {
+			return err
+		}
+	}
+	// apply properties of directories at last and the deepest first, writing children changes mtime
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := applyNodeProperties(dirs[i].path, dirs[i].dir.GetNodeProperties(), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFiles downloads files of all dirs concurrently, it stops at the first error
+func (s *ExecutorServer) writeFiles(ctx context.Context, casCache interfaces.Cache, dirs []inputDir) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, s.inputFetchConcurrency)
+schedule:
+	for _, d := range dirs {
+		for _, file := range d.dir.GetFiles() {
+			if err := validName(file.GetName()); err != nil {
+				once.Do(func() { firstErr = err })
+				break schedule
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				break schedule
+			}
+			wg.Add(1)
+			go func(fn string, file *repb.FileNode) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if err := s.writeFile(ctx, casCache, fn, file); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}(filepath.Join(d.path, file.GetName()), file)
+		}
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func inputFileMode(file *repb.FileNode) os.FileMode {
+	if file.GetIsExecutable() {
+		return 0555
+	}
+	return 0644
+}
+
+func (s *ExecutorServer) writeFile(ctx context.Context, casCache interfaces.Cache, fn string, file *repb.FileNode) error {
+	if local, ok := casCache.(interfaces.LocalFileCache); ok && s.linkInputs && file.GetDigest().GetHash() != EmptySha {
+		linked, err := s.linkInput(ctx, casCache, local, fn, file)
+		if err != nil || linked {
+			return err
+		}
+	}
+	mode := inputFileMode(file)
+	fi, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	d := file.GetDigest()
+	// Get file contents
+	if d.GetHash() != EmptySha {
+		r, err := casCache.Reader(ctx, d, 0)
+		if err != nil {
+			fi.Close()
+			logrus.WithError(err).Errorf("read %s for %s", d.GetHash(), fn)
+			return notFoundAsMissing(err, d)
+		}
+		_, err = io.Copy(fi, r)
+		r.Close()
+		if err != nil {
+			fi.Close()
+			return err
+		}
+	}
+	if err := fi.Close(); err != nil {
+		return err
+	}
+	return applyNodeProperties(fn, file.GetNodeProperties(), false)
+}
+
+// linkInput hardlinks the blob kept by the local cache to fn. Executable files and files
+// with node properties need their own inode, they are reflinked or copied instead, so node
+// properties are never applied to the inode shared with the cache.
+// It returns false if the blob is not in the local cache, or it was corrupted and removed from the cache.
+func (s *ExecutorServer) linkInput(ctx context.Context, casCache interfaces.Cache, local interfaces.LocalFileCache, fn string, file *repb.FileNode) (bool, error) {
+	d := file.GetDigest()
+	src, release, err := local.Acquire(ctx, d)
+	if err != nil {
+		if status.IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	// the pin only needs to cover linking, the inode outlives the cache entry once linked
+	defer release()
+	// blobs can still be rewritten through hardlinks if link_inputs is enabled for actions able to write inputs
+	if ok, err := s.verifiedBlobs.verify(src, d); err != nil || !ok {
+		logrus.WithError(err).Warnf("blob %s/%d in local cache is corrupted, remove it", d.GetHash(), d.GetSizeBytes())
+		if err := casCache.Delete(ctx, d); err != nil {
+			logrus.WithError(err).Warnf("remove corrupted blob %s", d.GetHash())
+		}
+		return false, nil
+	}
+	if !file.GetIsExecutable() && file.GetNodeProperties() == nil {
+		// inputs share the inode with the cache, making it read-only keeps actions from writing it by accident,
+		// blobs rewritten on purpose are caught by verifying them before the next use
+		if err := os.Chmod(src, 0444); err != nil {
+			return false, err
+		}
+		err := os.Link(src, fn)
+		if err == nil {
+			return true, nil
+		}
+		logrus.WithError(err).Debugf("hardlink %s to %s, fallback to copy", src, fn)
+	}
+	if err := cloneFile(src, fn, inputFileMode(file)); err != nil {
+		return false, err
+	}
+	return true, applyNodeProperties(fn, file.GetNodeProperties(), false)
+}
+
+// cloneFile reflinks src to dst if the filesystem supports it, otherwise copies it
+func cloneFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
+
+func writeSymlinks(symlinks []*repb.SymlinkNode, base string) error {
+	for _, symlink := range symlinks {
+		if err := validName(symlink.GetName()); err != nil {
+			return err
+		}
+		if filepath.IsAbs(symlink.GetTarget()) && symlinkAbsolutePathStrategy == repb.SymlinkAbsolutePathStrategy_DISALLOWED {
+			return status.InvalidArgumentErrorf("input symlink %s has absolute target %s", symlink.GetName(), symlink.GetTarget())
+		}
+		fn := filepath.Join(base, symlink.GetName())
+		if err := os.Symlink(symlink.GetTarget(), fn); err != nil && !os.IsExist(err) {
+			return err
+		}
+		if err := applyNodeProperties(fn, symlink.GetNodeProperties(), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyNodeProperties sets the unix mode and mtime of fn, mode of symlink is ignored
+// for it is not supported on linux.
+func applyNodeProperties(fn string, props *repb.NodeProperties, isSymlink bool) error {
+	if props == nil {
+		return nil
+	}
+	if props.GetUnixMode() != nil && !isSymlink {
+		if err := os.Chmod(fn, os.FileMode(props.GetUnixMode().GetValue()&07777)); err != nil {
+			return err
+		}
+	}
+	if props.GetMtime() != nil {
+		mtime := props.GetMtime().AsTime()
+		ts := []unix.Timespec{unix.NsecToTimespec(mtime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, fn, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return &os.PathError{Op: "utimes", Path: fn, Err: err}
+		}
+	}
+	return nil
+}
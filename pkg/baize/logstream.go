@@ -0,0 +1,177 @@
+package baize
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/bytestream"
+
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// defaultLogStreamRetention is how long outputs of a finished action can still be read from its log streams,
+// clients should read StdoutDigest and StderrDigest of the ActionResult after that.
+const defaultLogStreamRetention = time.Minute
+
+// defaultMaxLogStreamSize is how much of outputs of an action is held by its log stream,
+// outputs after that are only available by StdoutDigest and StderrDigest of the ActionResult.
+const defaultMaxLogStreamSize = 4 * 1024 * 1024
+
+// logStream holds the stdout or stderr of a running action, it can be read while being written
+type logStream struct {
+	mu      sync.Mutex
+	data    []byte
+	maxSize int
+	closed  bool
+	// changed is closed and replaced every time data is written or the stream is closed
+	changed chan struct{}
+}
+
+func newLogStream(maxSize int) *logStream {
+	return &logStream{maxSize: maxSize, changed: make(chan struct{})}
+}
+
+// Write appends p to the stream, data over maxSize or written after the stream
+// is closed is dropped silently since the command writing it must not fail for it.
+func (l *logStream) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := len(p)
+	if l.closed {
+		return n, nil
+	}
+	if room := l.maxSize - len(l.data); room < len(p) {
+		if room <= 0 {
+			return n, nil
+		}
+		p = p[:room]
+	}
+	l.data = append(l.data, p...)
+	close(l.changed)
+	l.changed = make(chan struct{})
+	return n, nil
+}
+
+func (l *logStream) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.closed = true
+	close(l.changed)
+}
+
+// snapshot returns data after offset, whether all data is written and a channel closed on next change
+func (l *logStream) snapshot(offset int64) ([]byte, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var data []byte
+	if offset < int64(len(l.data)) {
+		data = l.data[offset:]
+	}
+	return data, l.closed, l.changed
+}
+
+// logStreamStore holds log streams of actions executing and finished ones within retention
+type logStreamStore struct {
+	mu        sync.Mutex
+	streams   map[string]*logStream
+	retention time.Duration
+	maxSize   int
+}
+
+func newLogStreamStore() *logStreamStore {
+	return &logStreamStore{
+		streams:   make(map[string]*logStream),
+		retention: defaultLogStreamRetention,
+		maxSize:   defaultMaxLogStreamSize,
+	}
+}
+
+// logStreamNames returns names of the stdout and stderr streams of a new execution
+func logStreamNames(instanceName string) (string, string) {
+	prefix := fmt.Sprintf("%s/%s", ResourceNameLogStreams, uuid.New().String())
+	if instanceName != "" {
+		prefix = fmt.Sprintf("%s/%s", instanceName, prefix)
+	}
+	return prefix + "/stdout", prefix + "/stderr"
+}
+
+// isLogStreamName reports whether the resource name is a log stream instead of a blob
+func isLogStreamName(name string) bool {
+	return strings.HasPrefix(name, ResourceNameLogStreams+"/") || strings.Contains(name, "/"+ResourceNameLogStreams+"/")
+}
+
+func (s *logStreamStore) open(name string) *logStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := newLogStream(s.maxSize)
+	s.streams[name] = l
+	return l
+}
+
+func (s *logStreamStore) get(name string) (*logStream, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, exists := s.streams[name]
+	return l, exists
+}
+
+// finish closes the stream, readers get EOF after reading all data
+func (s *logStreamStore) finish(name string) {
+	l, exists := s.get(name)
+	if !exists {
+		return
+	}
+	l.close()
+	time.AfterFunc(s.retention, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.streams, name)
+		logrus.Tracef("log stream %s expired", name)
+	})
+}
+
+// readLogStream sends data of the stream to server as it is written until the stream is closed
+func (s *ExecutorServer) readLogStream(in *bytestream.ReadRequest, server bytestream.ByteStream_ReadServer) error {
+	l, exists := s.logStreams.get(in.GetResourceName())
+	if !exists {
+		return status.NotFoundErrorf("log stream %s not found", in.GetResourceName())
+	}
+	offset := in.GetReadOffset()
+	var sent int64
+	for {
+		data, closed, changed := l.snapshot(offset)
+		for len(data) > 0 {
+			n := int64(len(data))
+			if n > DefaultReadCapacity {
+				n = DefaultReadCapacity
+			}
+			if in.GetReadLimit() > 0 && sent+n > in.GetReadLimit() {
+				n = in.GetReadLimit() - sent
+			}
+			if err := server.Send(&bytestream.ReadResponse{Data: data[:n]}); err != nil {
+				return status.InternalErrorf("fail to send response to client: %s", err)
+			}
+			data = data[n:]
+			offset += n
+			sent += n
+			if in.GetReadLimit() > 0 && sent >= in.GetReadLimit() {
+				return nil
+			}
+		}
+		if closed {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-server.Context().Done():
+			return status.CanceledErrorf("read log stream %s canceled: %s", in.GetResourceName(), server.Context().Err())
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package baize
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/grpc"
+)
+
+type fakeReadServer struct {
+	grpc.ServerStream
+	ctx  context.Context
+	mu   sync.Mutex
+	data []byte
+}
+
+func (f *fakeReadServer) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeReadServer) Send(resp *bytestream.ReadResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data = append(f.data, resp.GetData()...)
+	return nil
+}
+
+func (f *fakeReadServer) received() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return string(f.data)
+}
+
+var _ = Describe("test log streams", func() {
+	var (
+		s      *ExecutorServer
+		stdout string
+	)
+	BeforeEach(func() {
+		s = &ExecutorServer{logStreams: newLogStreamStore()}
+		stdout, _ = logStreamNames("instance")
+		Expect(isLogStreamName(stdout)).To(BeTrue())
+		s.logStreams.open(stdout)
+	})
+	It("read outputs while being written", func() {
+		l, exists := s.logStreams.get(stdout)
+		Expect(exists).To(BeTrue())
+		_, err := l.Write([]byte("hello"))
+		Expect(err).To(BeNil())
+
+		server := &fakeReadServer{ctx: context.Background()}
+		done := make(chan error)
+		go func() {
+			done <- s.Read(&bytestream.ReadRequest{ResourceName: stdout}, server)
+		}()
+		Eventually(server.received).Should(Equal("hello"))
+		Consistently(done).ShouldNot(Receive())
+		_, err = l.Write([]byte(" world"))
+		Expect(err).To(BeNil())
+		Eventually(server.received).Should(Equal("hello world"))
+		s.logStreams.finish(stdout)
+		Eventually(done).Should(Receive(BeNil()))
+	})
+	It("read with offset and limit", func() {
+		l, _ := s.logStreams.get(stdout)
+		_, err := l.Write([]byte("hello world"))
+		Expect(err).To(BeNil())
+		server := &fakeReadServer{ctx: context.Background()}
+		Expect(s.Read(&bytestream.ReadRequest{ResourceName: stdout, ReadOffset: 6, ReadLimit: 3}, server)).To(BeNil())
+		Expect(server.received()).To(Equal("wor"))
+	})
+	It("drop outputs over max size", func() {
+		s.logStreams.maxSize = 5
+		other, _ := logStreamNames("")
+		l := s.logStreams.open(other)
+		n, err := l.Write([]byte("hello"))
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(5))
+		n, err = l.Write([]byte(" world"))
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(6))
+		s.logStreams.finish(other)
+		server := &fakeReadServer{ctx: context.Background()}
+		Expect(s.Read(&bytestream.ReadRequest{ResourceName: other}, server)).To(BeNil())
+		Expect(server.received()).To(Equal("hello"))
+	})
+	It("drop outputs written after finish", func() {
+		l, _ := s.logStreams.get(stdout)
+		_, err := l.Write([]byte("hello"))
+		Expect(err).To(BeNil())
+		s.logStreams.finish(stdout)
+		n, err := l.Write([]byte(" world"))
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(6))
+		server := &fakeReadServer{ctx: context.Background()}
+		Expect(s.Read(&bytestream.ReadRequest{ResourceName: stdout}, server)).To(BeNil())
+		Expect(server.received()).To(Equal("hello"))
+	})
+	It("unknown log stream", func() {
+		other, _ := logStreamNames("")
+		err := s.Read(&bytestream.ReadRequest{ResourceName: other}, &fakeReadServer{ctx: context.Background()})
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,318 @@
+package baize
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/longrunning"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/dashjay/baize/pkg/utils/digest"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+const (
+	// defaultOperationRetention is how long a completed operation can still be waited
+	defaultOperationRetention = 10 * time.Minute
+
+	// defaultWaitOperationTimeout is used when WaitOperation has no timeout
+	defaultWaitOperationTimeout = time.Minute
+)
+
+// operation tracks an execution, any number of WaitExecution streams can wait on it.
+type operation struct {
+	mu       sync.Mutex
+	name     string
+	resource *digest.ResourceName
+	stage    repb.ExecutionStage_Value
+	response *repb.ExecuteResponse
+	// queued is when the operation was created, it is the QueuedTimestamp of the action
+	queued time.Time
+	// changed is closed and replaced every time the operation updates
+	changed chan struct{}
+	// cancel stops the execution of the operation
+	cancel context.CancelFunc
+	// callers is how many Execute requests share the operation, the execution is only
+	// canceled by CancelOperation after all of them canceled it.
+	callers int
+	// stdoutStream and stderrStream are names of log streams of the command, empty if not available
+	stdoutStream string
+	stderrStream string
+}
+
+func newOperation(name string, r *digest.ResourceName, cancel context.CancelFunc) *operation {
+	return &operation{
+		name:     name,
+		resource: r,
+		stage:    repb.ExecutionStage_QUEUED,
+		queued:   time.Now(),
+		changed:  make(chan struct{}),
+		cancel:   cancel,
+		callers:  1,
+	}
+}
+
+// addCaller counts an Execute request merged into the operation
+func (o *operation) addCaller() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.callers++
+}
+
+// cancelByCaller cancels the execution once the last caller sharing the operation canceled it,
+// it returns false if other callers are still waiting for the result.
+func (o *operation) cancelByCaller() bool {
+	o.mu.Lock()
+	if o.callers > 0 {
+		o.callers--
+	}
+	last := o.callers == 0
+	o.mu.Unlock()
+	if last {
+		o.cancel()
+	}
+	return last
+}
+
+// update sets the stage of operation, response is only required when stage is COMPLETED
+func (o *operation) update(stage repb.ExecutionStage_Value, response *repb.ExecuteResponse) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.stage == repb.ExecutionStage_COMPLETED {
+		return
+	}
+	o.stage = stage
+	o.response = response
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// snapshot returns the current state and a channel closed on next update
+func (o *operation) snapshot() (repb.ExecutionStage_Value, *repb.ExecuteResponse, <-chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stage, o.response, o.changed
+}
+
+func (o *operation) toProto() (*longrunning.Operation, error) {
+	stage, response, _ := o.snapshot()
+	return o.assemble(stage, response)
+}
+
+func (o *operation) assemble(stage repb.ExecutionStage_Value, response *repb.ExecuteResponse) (*longrunning.Operation, error) {
+	if response == nil {
+		response = InProgressExecuteResponse()
+	}
+	return assembleOperation(o.name, &repb.ExecuteOperationMetadata{
+		Stage:            stage,
+		ActionDigest:     o.resource.GetDigest(),
+		StdoutStreamName: o.stdoutStream,
+		StderrStreamName: o.stderrStream,
+	}, response)
+}
+
+// wait sends every update of the operation to stream until it completed
+func (o *operation) wait(stream StreamLike) error {
+	for {
+		stage, response, changed := o.snapshot()
+		op, err := o.assemble(stage, response)
+		if err != nil {
+			return status.InternalErrorf("Error updating state of %q: %s", o.name, err)
+		}
+		if err := sendOperation(stream, op); err != nil {
+			return err
+		}
+		if stage == repb.ExecutionStage_COMPLETED {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return status.CanceledErrorf("wait operation %s canceled: %s", o.name, stream.Context().Err())
+		}
+	}
+}
+
+// operationStore holds operations in flight and completed ones within retention
+type operationStore struct {
+	mu         sync.Mutex
+	operations map[string]*operation
+	// inflight indexes operations not completed by instance name and action digest,
+	// so that identical actions executing concurrently can be merged.
+	inflight  map[string]*operation
+	retention time.Duration
+}
+
+func newOperationStore() *operationStore {
+	return &operationStore{
+		operations: make(map[string]*operation),
+		inflight:   make(map[string]*operation),
+		retention:  defaultOperationRetention,
+	}
+}
+
+// put registers the operation, if merge is set and an operation of the same action is in flight,
+// it returns the existing one and true instead. Operations put without merge are never merged into.
+func (s *operationStore) put(op *operation, merge bool) (*operation, bool) {
+	key := op.resource.DownloadString()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations[op.name] = op
+	if !merge {
+		return op, false
+	}
+	if existing, exists := s.inflight[key]; exists {
+		delete(s.operations, op.name)
+		existing.addCaller()
+		return existing, true
+	}
+	s.inflight[key] = op
+	return op, false
+}
+
+func (s *operationStore) get(name string) (*operation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, exists := s.operations[name]
+	return op, exists
+}
+
+// list returns operations sorted by name
+func (s *operationStore) list() []*operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*operation, 0, len(s.operations))
+	for _, op := range s.operations {
+		out = append(out, op)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].name < out[j].name
+	})
+	return out
+}
+
+// delete forgets the operation, an operation deleted in flight is no longer merged into
+func (s *operationStore) delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, exists := s.operations[name]
+	if !exists {
+		return
+	}
+	delete(s.operations, name)
+	key := op.resource.DownloadString()
+	if s.inflight[key] == op {
+		delete(s.inflight, key)
+	}
+}
+
+// complete marks the operation completed and removes it from store after retention
+func (s *operationStore) complete(op *operation, response *repb.ExecuteResponse) {
+	s.mu.Lock()
+	key := op.resource.DownloadString()
+	if s.inflight[key] == op {
+		delete(s.inflight, key)
+	}
+	s.mu.Unlock()
+	op.update(repb.ExecutionStage_COMPLETED, response)
+	time.AfterFunc(s.retention, func() {
+		s.delete(op.name)
+		logrus.Tracef("operation %s expired", op.name)
+	})
+}
+
+func (s *ExecutorServer) getOperation(name string) (*operation, error) {
+	op, exists := s.operations.get(name)
+	if !exists {
+		return nil, status.NotFoundErrorf("operation %s not found", name)
+	}
+	return op, nil
+}
+
+func (s *ExecutorServer) GetOperation(ctx context.Context, in *longrunning.GetOperationRequest) (*longrunning.Operation, error) {
+	op, err := s.getOperation(in.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return op.toProto()
+}
+
+// ListOperations lists operations in flight and completed ones within retention,
+// page_token is the name of the last operation of previous page.
+func (s *ExecutorServer) ListOperations(ctx context.Context, in *longrunning.ListOperationsRequest) (*longrunning.ListOperationsResponse, error) {
+	if in.GetFilter() != "" {
+		return nil, status.InvalidArgumentError("filter is not supported")
+	}
+	resp := &longrunning.ListOperationsResponse{}
+	for _, op := range s.operations.list() {
+		if op.name <= in.GetPageToken() {
+			continue
+		}
+		if in.GetPageSize() > 0 && len(resp.Operations) == int(in.GetPageSize()) {
+			resp.NextPageToken = resp.Operations[len(resp.Operations)-1].GetName()
+			break
+		}
+		pb, err := op.toProto()
+		if err != nil {
+			return nil, err
+		}
+		resp.Operations = append(resp.Operations, pb)
+	}
+	return resp, nil
+}
+
+// DeleteOperation forgets the operation, it does not cancel the execution
+func (s *ExecutorServer) DeleteOperation(ctx context.Context, in *longrunning.DeleteOperationRequest) (*emptypb.Empty, error) {
+	if _, err := s.getOperation(in.GetName()); err != nil {
+		return nil, err
+	}
+	s.operations.delete(in.GetName())
+	return &emptypb.Empty{}, nil
+}
+
+// CancelOperation stops the execution, the running process group will be killed.
+// Execute requests merged into one operation share its name, every CancelOperation counts as one of them
+// giving up, and the execution is only stopped after all of them canceled it.
+func (s *ExecutorServer) CancelOperation(ctx context.Context, in *longrunning.CancelOperationRequest) (*emptypb.Empty, error) {
+	op, err := s.getOperation(in.GetName())
+	if err != nil {
+		return nil, err
+	}
+	if !op.cancelByCaller() {
+		logrus.Infof("operation %s is shared by other callers, keep it running", op.name)
+		return &emptypb.Empty{}, nil
+	}
+	logrus.Infof("cancel operation %s", op.name)
+	return &emptypb.Empty{}, nil
+}
+
+// WaitOperation waits until the operation is done or timeout, and returns the latest state
+func (s *ExecutorServer) WaitOperation(ctx context.Context, in *longrunning.WaitOperationRequest) (*longrunning.Operation, error) {
+	op, err := s.getOperation(in.GetName())
+	if err != nil {
+		return nil, err
+	}
+	timeout := defaultWaitOperationTimeout
+	if in.GetTimeout() != nil {
+		timeout = in.GetTimeout().AsDuration()
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		stage, _, changed := op.snapshot()
+		if stage == repb.ExecutionStage_COMPLETED {
+			return op.toProto()
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return op.toProto()
+		case <-ctx.Done():
+			return nil, status.CanceledErrorf("wait operation %s canceled: %s", op.name, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package baize
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/longrunning"
+	"google.golang.org/grpc/codes"
+
+	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/digest"
+)
+
+type fakeStream struct {
+	ctx context.Context
+	mu  sync.Mutex
+	ops []*longrunning.Operation
+}
+
+func (f *fakeStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeStream) Send(op *longrunning.Operation) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ops = append(f.ops, op)
+	return nil
+}
+
+func (f *fakeStream) stages() []repb.ExecutionStage_Value {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []repb.ExecutionStage_Value
+	for _, op := range f.ops {
+		eom := &repb.ExecuteOperationMetadata{}
+		Expect(op.GetMetadata().UnmarshalTo(eom)).To(BeNil())
+		out = append(out, eom.GetStage())
+	}
+	return out
+}
+
+var _ = Describe("test operation store", func() {
+	var (
+		store *operationStore
+		op    *operation
+	)
+	BeforeEach(func() {
+		store = newOperationStore()
+		r := digest.NewResourceName(utils.CalSHA256OfInput([]byte("action")), "")
+		name, err := r.UploadString()
+		Expect(err).To(BeNil())
+		op = newOperation(name, r, func() {})
+		_, merged := store.put(op, true)
+		Expect(merged).To(BeFalse())
+	})
+	It("all waiters receive the completed operation", func() {
+		streams := []*fakeStream{{ctx: context.Background()}, {ctx: context.Background()}}
+		var wg sync.WaitGroup
+		for _, stream := range streams {
+			wg.Add(1)
+			go func(stream *fakeStream) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(op.wait(stream)).To(BeNil())
+			}(stream)
+		}
+		op.update(repb.ExecutionStage_EXECUTING, nil)
+		store.complete(op, ExecuteResponseWithResult(&repb.ActionResult{ExitCode: 1}, codes.OK))
+		wg.Wait()
+		for _, stream := range streams {
+			stages := stream.stages()
+			Expect(stages[len(stages)-1]).To(Equal(repb.ExecutionStage_COMPLETED))
+			Expect(stream.ops[len(stream.ops)-1].GetDone()).To(BeTrue())
+		}
+	})
+	It("waiter attached after completion gets the result", func() {
+		store.complete(op, ExecuteResponseWithResult(&repb.ActionResult{}, codes.OK))
+		got, exists := store.get(op.name)
+		Expect(exists).To(BeTrue())
+		stream := &fakeStream{ctx: context.Background()}
+		Expect(got.wait(stream)).To(BeNil())
+		Expect(stream.stages()).To(Equal([]repb.ExecutionStage_Value{repb.ExecutionStage_COMPLETED}))
+	})
+	It("waiter returns when its stream is done", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		stream := &fakeStream{ctx: ctx}
+		Expect(op.wait(stream)).NotTo(BeNil())
+		Expect(stream.stages()[0]).To(Equal(repb.ExecutionStage_QUEUED))
+	})
+	It("completed operation expires after retention", func() {
+		store.retention = 10 * time.Millisecond
+		store.complete(op, ExecuteResponseWithResult(&repb.ActionResult{}, codes.OK))
+		Eventually(func() bool {
+			_, exists := store.get(op.name)
+			return exists
+		}).Should(BeFalse())
+	})
+	It("merge operations of the same action in flight", func() {
+		name, err := op.resource.UploadString()
+		Expect(err).To(BeNil())
+		got, merged := store.put(newOperation(name, op.resource, func() {}), true)
+		Expect(merged).To(BeTrue())
+		Expect(got).To(Equal(op))
+
+		other := digest.NewResourceName(op.resource.GetDigest(), "other-instance")
+		name, err = other.UploadString()
+		Expect(err).To(BeNil())
+		_, merged = store.put(newOperation(name, other, func() {}), true)
+		Expect(merged).To(BeFalse())
+	})
+	It("do not merge operations put without merge", func() {
+		name, err := op.resource.UploadString()
+		Expect(err).To(BeNil())
+		uncached := newOperation(name, op.resource, func() {})
+		got, merged := store.put(uncached, false)
+		Expect(merged).To(BeFalse())
+		Expect(got).To(Equal(uncached))
+		_, exists := store.get(name)
+		Expect(exists).To(BeTrue())
+
+		// the operation in flight is still merged into, but never the one put without merge
+		name, err = op.resource.UploadString()
+		Expect(err).To(BeNil())
+		got, merged = store.put(newOperation(name, op.resource, func() {}), true)
+		Expect(merged).To(BeTrue())
+		Expect(got).To(Equal(op))
+		store.complete(op, ExecuteResponseWithResult(&repb.ActionResult{}, codes.OK))
+		got, merged = store.put(newOperation(name, op.resource, func() {}), true)
+		Expect(merged).To(BeFalse())
+		Expect(got).NotTo(Equal(uncached))
+	})
+	It("do not merge into deleted operation", func() {
+		store.delete(op.name)
+		name, err := op.resource.UploadString()
+		Expect(err).To(BeNil())
+		got, merged := store.put(newOperation(name, op.resource, func() {}), true)
+		Expect(merged).To(BeFalse())
+		Expect(got).NotTo(Equal(op))
+		_, exists := store.get(got.name)
+		Expect(exists).To(BeTrue())
+	})
+	It("do not merge into completed operation", func() {
+		store.complete(op, ExecuteResponseWithResult(&repb.ActionResult{}, codes.OK))
+		name, err := op.resource.UploadString()
+		Expect(err).To(BeNil())
+		got, merged := store.put(newOperation(name, op.resource, func() {}), true)
+		Expect(merged).To(BeFalse())
+		Expect(got).NotTo(Equal(op))
+	})
+})
+
+var _ = Describe("test operations service", func() {
+	var (
+		ctx   = context.Background()
+		s     *ExecutorServer
+		names []string
+	)
+	BeforeEach(func() {
+		s = &ExecutorServer{operations: newOperationStore()}
+		names = nil
+		for _, input := range []string{"a", "b", "c"} {
+			r := digest.NewResourceName(utils.CalSHA256OfInput([]byte(input)), "")
+			name, err := r.UploadString()
+			Expect(err).To(BeNil())
+			s.operations.put(newOperation(name, r, func() {}), true)
+			names = append(names, name)
+		}
+	})
+	It("list operations by page", func() {
+		resp, err := s.ListOperations(ctx, &longrunning.ListOperationsRequest{PageSize: 2})
+		Expect(err).To(BeNil())
+		Expect(resp.GetOperations()).To(HaveLen(2))
+		Expect(resp.GetNextPageToken()).NotTo(BeEmpty())
+		resp, err = s.ListOperations(ctx, &longrunning.ListOperationsRequest{PageSize: 2, PageToken: resp.GetNextPageToken()})
+		Expect(err).To(BeNil())
+		Expect(resp.GetOperations()).To(HaveLen(1))
+		Expect(resp.GetNextPageToken()).To(BeEmpty())
+	})
+	It("cancel operation", func() {
+		canceled := make(chan struct{})
+		r := digest.NewResourceName(utils.CalSHA256OfInput([]byte("d")), "")
+		name, err := r.UploadString()
+		Expect(err).To(BeNil())
+		s.operations.put(newOperation(name, r, func() { close(canceled) }), true)
+		_, err = s.CancelOperation(ctx, &longrunning.CancelOperationRequest{Name: name})
+		Expect(err).To(BeNil())
+		Eventually(canceled).Should(BeClosed())
+	})
+	It("cancel merged operation after all callers canceled it", func() {
+		canceled := make(chan struct{})
+		r := digest.NewResourceName(utils.CalSHA256OfInput([]byte("d")), "")
+		name, err := r.UploadString()
+		Expect(err).To(BeNil())
+		op, _ := s.operations.put(newOperation(name, r, func() { close(canceled) }), true)
+		other, err := r.UploadString()
+		Expect(err).To(BeNil())
+		_, merged := s.operations.put(newOperation(other, r, func() {}), true)
+		Expect(merged).To(BeTrue())
+
+		_, err = s.CancelOperation(ctx, &longrunning.CancelOperationRequest{Name: op.name})
+		Expect(err).To(BeNil())
+		Consistently(canceled).ShouldNot(BeClosed())
+		_, err = s.CancelOperation(ctx, &longrunning.CancelOperationRequest{Name: op.name})
+		Expect(err).To(BeNil())
+		Eventually(canceled).Should(BeClosed())
+	})
+	It("get and delete operation", func() {
+		op, err := s.GetOperation(ctx, &longrunning.GetOperationRequest{Name: names[0]})
+		Expect(err).To(BeNil())
+		Expect(op.GetDone()).To(BeFalse())
+		_, err = s.DeleteOperation(ctx, &longrunning.DeleteOperationRequest{Name: names[0]})
+		Expect(err).To(BeNil())
+		_, err = s.GetOperation(ctx, &longrunning.GetOperationRequest{Name: names[0]})
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,341 @@
+package baize
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// outputKind is the type of output declared by the command
+type outputKind int
+
+const (
+	outputFile outputKind = iota
+	outputDirectory
+	// outputPath is declared by output_paths, its type is decided by what the action produced
+	outputPath
+)
+
+type declaredOutput struct {
+	path string
+	kind outputKind
+}
+
+// declaredOutputs returns outputs of the command, output_paths takes place of
+// output_files and output_directories if it is set.
+func declaredOutputs(command *repb.Command) []declaredOutput {
+	var outputs []declaredOutput
+	if len(command.GetOutputPaths()) > 0 {
+		for _, p := range command.GetOutputPaths() {
+			outputs = append(outputs, declaredOutput{path: p, kind: outputPath})
+		}
+		return outputs
+	}
+	for _, p := range command.GetOutputFiles() {
+		outputs = append(outputs, declaredOutput{path: p, kind: outputFile})
+	}
+	for _, p := range command.GetOutputDirectories() {
+		outputs = append(outputs, declaredOutput{path: p, kind: outputDirectory})
+	}
+	return outputs
+}
+
+// prepareOutputs creates parent directories of all outputs before the command runs
+func prepareOutputs(workdir string, command *repb.Command) error {
+	for _, output := range declaredOutputs(command) {
+		if err := validOutputPath(output.path); err != nil {
+			return err
+		}
+		if err := mkdirUnder(workdir, filepath.Dir(output.path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validOutputPath rejects output paths which are not under the working directory
+func validOutputPath(p string) error {
+	cleaned := filepath.Clean(p)
+	if p == "" || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return status.InvalidArgumentErrorf("output path %q is not under the working directory", p)
+	}
+	return nil
+}
+
+// mkdirUnder creates rel under root like os.MkdirAll, but it never follows symlinks the action
+// or its inputs put on the way, so nothing is created out of root.
+func mkdirUnder(root, rel string) error {
+	dir := root
+	for _, name := range strings.Split(filepath.Clean(rel), string(filepath.Separator)) {
+		dir = filepath.Join(dir, name)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(dir, os.ModePerm); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return status.FailedPreconditionErrorf("%s in %s is not a directory", name, rel)
+		}
+	}
+	return nil
+}
+
+// lstatUnder is os.Lstat of rel under root, it fails if any parent of rel is not a directory,
+// so symlinks in the middle of rel are never followed.
+func lstatUnder(root, rel string) (os.FileInfo, error) {
+	names := strings.Split(filepath.Clean(rel), string(filepath.Separator))
+	fn := root
+	for i, name := range names {
+		fn = filepath.Join(fn, name)
+		info, err := os.Lstat(fn)
+		if err != nil || i == len(names)-1 {
+			return info, err
+		}
+		if !info.IsDir() {
+			return nil, status.FailedPreconditionErrorf("%s in output %s is not a directory", name, rel)
+		}
+	}
+	return nil, nil
+}
+
+// outputCollector uploads outputs of an action into CAS and fills them into ActionResult
+type outputCollector struct {
+	ctx     context.Context
+	cas     interfaces.Cache
+	workdir string
+	// symlinkStrategy decides whether output symlinks with absolute targets are accepted
+	symlinkStrategy repb.SymlinkAbsolutePathStrategy_Value
+}
+
+// collect fills outputs declared by command into ar, outputs not produced by the action are omitted.
+func (c *outputCollector) collect(command *repb.Command, ar *repb.ActionResult) error {
+	for _, output := range declaredOutputs(command) {
+		if err := validOutputPath(output.path); err != nil {
+			return err
+		}
+		fn := filepath.Join(c.workdir, output.path)
+		info, err := lstatUnder(c.workdir, output.path)
+		if os.IsNotExist(err) {
+			logrus.Debugf("output %s not produced", output.path)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if err := c.collectSymlink(output, fn, ar); err != nil {
+				return err
+			}
+		case info.IsDir():
+			if output.kind == outputFile {
+				return status.FailedPreconditionErrorf("output file %s is a directory", output.path)
+			}
+			treeDigest, err := c.uploadTree(fn)
+			if err != nil {
+				return err
+			}
+			ar.OutputDirectories = append(ar.OutputDirectories, &repb.OutputDirectory{
+				Path:       output.path,
+				TreeDigest: treeDigest,
+			})
+		case info.Mode().IsRegular():
+			if output.kind == outputDirectory {
+				return status.FailedPreconditionErrorf("output directory %s is a file", output.path)
+			}
+			d, err := c.uploadFile(fn)
+			if err != nil {
+				return err
+			}
+			ar.OutputFiles = append(ar.OutputFiles, &repb.OutputFile{
+				Path:         output.path,
+				Digest:       d,
+				IsExecutable: isExecutable(info),
+			})
+		default:
+			return status.FailedPreconditionErrorf("output %s is not a regular file, directory or symlink", output.path)
+		}
+	}
+	return nil
+}
+
+// collectSymlink reports the symlink as it is without following it, output_paths are reported
+// in output_symlinks, the typed output_file_symlinks and output_directory_symlinks are filled
+// if the type of target is known.
+func (c *outputCollector) collectSymlink(output declaredOutput, fn string, ar *repb.ActionResult) error {
+	target, err := c.readlink(fn)
+	if err != nil {
+		return err
+	}
+	symlink := &repb.OutputSymlink{Path: output.path, Target: target}
+	// dangling symlinks are allowed, their type is decided by the declaration
+	var targetIsDir, targetExists bool
+	if info, err := os.Stat(fn); err == nil {
+		targetExists = true
+		targetIsDir = info.IsDir()
+	}
+	switch output.kind {
+	case outputFile:
+		if targetIsDir {
+			return status.FailedPreconditionErrorf("output file %s is a symlink to directory", output.path)
+		}
+		ar.OutputFileSymlinks = append(ar.OutputFileSymlinks, symlink)
+	case outputDirectory:
+		if targetExists && !targetIsDir {
+			return status.FailedPreconditionErrorf("output directory %s is a symlink to file", output.path)
+		}
+		ar.OutputDirectorySymlinks = append(ar.OutputDirectorySymlinks, symlink)
+	default:
+		ar.OutputSymlinks = append(ar.OutputSymlinks, symlink)
+		if targetExists && targetIsDir {
+			ar.OutputDirectorySymlinks = append(ar.OutputDirectorySymlinks, symlink)
+		} else if targetExists {
+			ar.OutputFileSymlinks = append(ar.OutputFileSymlinks, symlink)
+		}
+	}
+	return nil
+}
+
+func (c *outputCollector) readlink(fn string) (string, error) {
+	target, err := os.Readlink(fn)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(target) && c.symlinkStrategy == repb.SymlinkAbsolutePathStrategy_DISALLOWED {
+		return "", status.FailedPreconditionErrorf("output symlink %s has absolute target %s", fn, target)
+	}
+	return target, nil
+}
+
+func isExecutable(info os.FileInfo) bool {
+	return info.Mode()&0111 != 0
+}
+
+func (c *outputCollector) put(d *repb.Digest, data []byte) error {
+	if d.GetHash() == EmptySha {
+		return nil
+	}
+	return c.cas.Set(c.ctx, d, data)
+}
+
+// uploadFile hashes the file and then streams it into CAS, the file is never read into memory as a whole
+func (c *outputCollector) uploadFile(fn string) (*repb.Digest, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := utils.CalSHA256FromReader(f)
+	if err != nil {
+		return nil, err
+	}
+	if d.GetHash() == EmptySha {
+		return d, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	w, err := c.cas.Writer(c.ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(w, f)
+	if err == nil && n != d.GetSizeBytes() {
+		err = status.DataLossErrorf("output %s changed while uploading", fn)
+	}
+	if err != nil {
+		// keep the blob already stored under d, if any, instead of the partial one
+		w.Abort()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		logrus.WithError(err).Errorf("upload output %s", fn)
+		return nil, err
+	}
+	return d, nil
+}
+
+func (c *outputCollector) uploadProto(m proto.Message) (*repb.Digest, error) {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return nil, status.InternalErrorf("marshal %T error: %s", m, err)
+	}
+	d := utils.CalSHA256OfInput(b)
+	if err := c.put(d, b); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// uploadTree uploads all files under dir and the repb.Tree of dir, returns digest of the Tree
+func (c *outputCollector) uploadTree(dir string) (*repb.Digest, error) {
+	tree := &repb.Tree{}
+	seen := make(map[string]bool)
+	root, _, err := c.uploadDirectory(dir, tree, seen)
+	if err != nil {
+		return nil, err
+	}
+	tree.Root = root
+	return c.uploadProto(tree)
+}
+
+// uploadDirectory builds the Directory of dir, directories under it are appended to tree.Children
+// once for every distinct digest.
+func (c *outputCollector) uploadDirectory(dir string, tree *repb.Tree, seen map[string]bool) (*repb.Directory, *repb.Digest, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := &repb.Directory{}
+	for _, entry := range entries {
+		fn := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.Mode()&os.ModeSymlink != 0:
+			target, err := c.readlink(fn)
+			if err != nil {
+				return nil, nil, err
+			}
+			out.Symlinks = append(out.Symlinks, &repb.SymlinkNode{Name: entry.Name(), Target: target})
+		case entry.IsDir():
+			child, d, err := c.uploadDirectory(fn, tree, seen)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !seen[d.GetHash()] {
+				seen[d.GetHash()] = true
+				tree.Children = append(tree.Children, child)
+			}
+			out.Directories = append(out.Directories, &repb.DirectoryNode{Name: entry.Name(), Digest: d})
+		case entry.Mode().IsRegular():
+			d, err := c.uploadFile(fn)
+			if err != nil {
+				return nil, nil, err
+			}
+			out.Files = append(out.Files, &repb.FileNode{Name: entry.Name(), Digest: d, IsExecutable: isExecutable(entry)})
+		default:
+			// opening FIFOs may block forever, sockets and devices can not be uploaded either
+			return nil, nil, status.FailedPreconditionErrorf("output %s is not a regular file, directory or symlink", fn)
+		}
+	}
+	b, err := proto.Marshal(out)
+	if err != nil {
+		return nil, nil, status.InternalErrorf("marshal directory %s error: %s", dir, err)
+	}
+	return out, utils.CalSHA256OfInput(b), nil
+}
@@ -0,0 +1,155 @@
+package baize
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/protobuf/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dashjay/baize/pkg/caches"
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+var _ = Describe("test output collector", func() {
+	var (
+		ctx       = context.Background()
+		workdir   string
+		collector *outputCollector
+	)
+	writeFile := func(name, content string, mode os.FileMode) {
+		fn := filepath.Join(workdir, name)
+		Expect(os.MkdirAll(filepath.Dir(fn), os.ModePerm)).To(BeNil())
+		Expect(ioutil.WriteFile(fn, []byte(content), mode)).To(BeNil())
+	}
+	BeforeEach(func() {
+		var err error
+		workdir, err = ioutil.TempDir("", "output-test-")
+		Expect(err).To(BeNil())
+		collector = &outputCollector{ctx: ctx, cas: casOf(newTestServer(workdir)), workdir: workdir}
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(workdir)).To(BeNil())
+	})
+	It("collect output directory into tree", func() {
+		writeFile("out/a.txt", "a", 0644)
+		writeFile("out/x/b.sh", "b", 0755)
+		writeFile("out/y/b.sh", "b", 0755)
+		ar := &repb.ActionResult{}
+		Expect(collector.collect(&repb.Command{OutputDirectories: []string{"out"}}, ar)).To(BeNil())
+		Expect(ar.GetOutputDirectories()).To(HaveLen(1))
+
+		data, err := collector.cas.Get(ctx, ar.GetOutputDirectories()[0].GetTreeDigest())
+		Expect(err).To(BeNil())
+		tree := &repb.Tree{}
+		Expect(proto.Unmarshal(data, tree)).To(BeNil())
+		Expect(tree.GetRoot().GetFiles()).To(HaveLen(1))
+		Expect(tree.GetRoot().GetDirectories()).To(HaveLen(2))
+		// x and y have the same content
+		Expect(tree.GetChildren()).To(HaveLen(1))
+		Expect(tree.GetChildren()[0].GetFiles()[0].GetIsExecutable()).To(BeTrue())
+		Expect(ValidateActionResult(ctx, collector.cas, ar)).To(BeNil())
+	})
+	It("decide type of output paths by what produced", func() {
+		writeFile("out/a.txt", "a", 0644)
+		writeFile("out/d/b.txt", "b", 0644)
+		ar := &repb.ActionResult{}
+		cmd := &repb.Command{OutputPaths: []string{"out/a.txt", "out/d", "out/missing"}, OutputFiles: []string{"ignored"}}
+		Expect(collector.collect(cmd, ar)).To(BeNil())
+		Expect(ar.GetOutputFiles()).To(HaveLen(1))
+		Expect(ar.GetOutputFiles()[0].GetIsExecutable()).To(BeFalse())
+		Expect(ar.GetOutputDirectories()).To(HaveLen(1))
+		Expect(ar.GetOutputDirectories()[0].GetPath()).To(Equal("out/d"))
+	})
+	It("report symlinks without following them", func() {
+		writeFile("out/a.txt", "a", 0644)
+		writeFile("out/d/b.txt", "b", 0644)
+		Expect(os.Symlink("a.txt", filepath.Join(workdir, "out/link-a"))).To(BeNil())
+		Expect(os.Symlink("d", filepath.Join(workdir, "out/link-d"))).To(BeNil())
+		Expect(os.Symlink("/nonexistent", filepath.Join(workdir, "out/dangling"))).To(BeNil())
+		Expect(os.Symlink("b.txt", filepath.Join(workdir, "out/d/link-b"))).To(BeNil())
+
+		ar := &repb.ActionResult{}
+		cmd := &repb.Command{OutputPaths: []string{"out/link-a", "out/link-d", "out/dangling", "out/d"}}
+		Expect(collector.collect(cmd, ar)).To(BeNil())
+		Expect(ar.GetOutputSymlinks()).To(HaveLen(3))
+		Expect(ar.GetOutputFileSymlinks()).To(Equal([]*repb.OutputSymlink{{Path: "out/link-a", Target: "a.txt"}}))
+		Expect(ar.GetOutputDirectorySymlinks()).To(Equal([]*repb.OutputSymlink{{Path: "out/link-d", Target: "d"}}))
+
+		data, err := collector.cas.Get(ctx, ar.GetOutputDirectories()[0].GetTreeDigest())
+		Expect(err).To(BeNil())
+		tree := &repb.Tree{}
+		Expect(proto.Unmarshal(data, tree)).To(BeNil())
+		Expect(tree.GetRoot().GetFiles()).To(HaveLen(1))
+		Expect(tree.GetRoot().GetSymlinks()).To(Equal([]*repb.SymlinkNode{{Name: "link-b", Target: "b.txt"}}))
+
+		ar = &repb.ActionResult{}
+		Expect(collector.collect(&repb.Command{OutputFiles: []string{"out/link-a"}, OutputDirectories: []string{"out/link-d"}}, ar)).To(BeNil())
+		Expect(ar.GetOutputFileSymlinks()).To(HaveLen(1))
+		Expect(ar.GetOutputDirectorySymlinks()).To(HaveLen(1))
+		Expect(ar.GetOutputSymlinks()).To(BeEmpty())
+
+		collector.symlinkStrategy = repb.SymlinkAbsolutePathStrategy_DISALLOWED
+		Expect(collector.collect(&repb.Command{OutputPaths: []string{"out/dangling"}}, &repb.ActionResult{})).NotTo(BeNil())
+	})
+	It("reject output of wrong type", func() {
+		writeFile("out/a.txt", "a", 0644)
+		Expect(collector.collect(&repb.Command{OutputDirectories: []string{"out/a.txt"}}, &repb.ActionResult{})).NotTo(BeNil())
+		Expect(collector.collect(&repb.Command{OutputFiles: []string{"out"}}, &repb.ActionResult{})).NotTo(BeNil())
+	})
+	It("reject output paths escaping the working directory", func() {
+		for _, p := range []string{"/etc/passwd", "../out", "out/../../out", ""} {
+			cmd := &repb.Command{OutputFiles: []string{p}}
+			Expect(status.IsInvalidArgumentError(prepareOutputs(workdir, cmd))).To(BeTrue(), p)
+			Expect(status.IsInvalidArgumentError(collector.collect(cmd, &repb.ActionResult{}))).To(BeTrue(), p)
+		}
+	})
+	It("never follow symlinks in the middle of output paths", func() {
+		outside, err := ioutil.TempDir("", "output-test-outside-")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(outside)
+		Expect(ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644)).To(BeNil())
+		Expect(os.Symlink(outside, filepath.Join(workdir, "link"))).To(BeNil())
+
+		Expect(prepareOutputs(workdir, &repb.Command{OutputFiles: []string{"link/sub/out"}})).NotTo(BeNil())
+		_, err = os.Stat(filepath.Join(outside, "sub"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		ar := &repb.ActionResult{}
+		Expect(collector.collect(&repb.Command{OutputFiles: []string{"link/secret"}}, ar)).NotTo(BeNil())
+		Expect(ar.GetOutputFiles()).To(BeEmpty())
+	})
+	It("reject special files in outputs", func() {
+		writeFile("out/a.txt", "a", 0644)
+		Expect(syscall.Mkfifo(filepath.Join(workdir, "out/fifo"), 0644)).To(BeNil())
+		Expect(collector.collect(&repb.Command{OutputDirectories: []string{"out"}}, &repb.ActionResult{})).NotTo(BeNil())
+		Expect(collector.collect(&repb.Command{OutputFiles: []string{"out/fifo"}}, &repb.ActionResult{})).NotTo(BeNil())
+	})
+	It("route output over the cutoff to the cache accepting it", func() {
+		cacheDir, err := ioutil.TempDir("", "output-test-cache-")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(cacheDir)
+		memory := caches.NewMemoryCache(&config.Cache{Enabled: true, CacheSize: 1 << 20, UnitSizeLimitation: 16})
+		disk := caches.NewDiskCache(&config.Cache{Enabled: true, CacheSize: 1 << 20, CacheAddr: cacheDir})
+		collector.cas, err = caches.NewComposedCache(memory, disk, 0).WithIsolation(ctx, interfaces.CASCacheType, "")
+		Expect(err).To(BeNil())
+
+		large := strings.Repeat("large", 1024)
+		writeFile("out/large.txt", large, 0644)
+		ar := &repb.ActionResult{}
+		Expect(collector.collect(&repb.Command{OutputFiles: []string{"out/large.txt"}}, ar)).To(BeNil())
+		d := ar.GetOutputFiles()[0].GetDigest()
+		Expect(d.GetSizeBytes()).To(Equal(int64(len(large))))
+		data, err := collector.cas.Get(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal(large))
+	})
+})
@@ -4,33 +4,132 @@ import (
 	"context"
 	"math"
 	"net"
+	"time"
 
+	"github.com/dashjay/baize/pkg/admission"
 	"github.com/dashjay/baize/pkg/caches"
 	"github.com/dashjay/baize/pkg/config"
 	"github.com/dashjay/baize/pkg/interfaces"
+	schedulerpb "github.com/dashjay/baize/pkg/proto/scheduler"
+	"github.com/dashjay/baize/pkg/runner"
+	"github.com/dashjay/baize/pkg/scheduler"
+	"github.com/dashjay/baize/pkg/utils/platform"
 
 	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
 	"github.com/bazelbuild/remote-apis/build/bazel/semver"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/genproto/googleapis/longrunning"
 	"google.golang.org/grpc"
 )
 
+const (
+	defaultActionTimeout = 15 * time.Minute
+	maxActionTimeout     = time.Hour
+
+	symlinkAbsolutePathStrategy = repb.SymlinkAbsolutePathStrategy_ALLOWED
+)
+
 type ExecutorServer struct {
 	grpcServer *grpc.Server
 	listenAddr string
 	workDir    string
 	cache      interfaces.Cache
+	// actionCache holds policies deciding which results of executed actions are cached by instance
+	actionCache *config.ActionCacheConfig
+	operations  *operationStore
+	// logStreams holds stdout and stderr of actions executed by this server
+	logStreams *logStreamStore
+
+	// keepActionDirs disables removing directories of actions after execution
+	keepActionDirs bool
+	// linkInputs enables hardlinking input files from local disk cache
+	linkInputs bool
+	// inputFetchConcurrency bounds downloading of input files of an action
+	inputFetchConcurrency int
+	directories           *directoryCache
+	// verifiedBlobs remembers blobs of the local cache checked before being linked into exec roots
+	verifiedBlobs *verifiedBlobs
+
+	defaultActionTimeout time.Duration
+	maxActionTimeout     time.Duration
+
+	// platform is what this server declares, actions executed locally must be satisfied by it
+	platform *repb.Platform
+	// runners runs commands on the host or in containers by container-image of actions
+	runners *runner.Runners
+	// admission limits actions run by this server at the same time by CPU slots and memory they request
+	admission *admission.Controller
+	// worker names this server in ExecutedActionMetadata of actions it runs
+	worker string
+
+	// scheduler is only set when running as baize-server
+	scheduler *scheduler.Scheduler
 }
 
+// New returns an ExecutorServer listening at executor listen_addr
 func New(cfg *config.Configure) (*ExecutorServer, error) {
+	return newExecutorServer(cfg, cfg.GetExecutorConfig().ListenAddr)
+}
+
+// NewServer returns an ExecutorServer listening at server listen_addr,
+// which also serves the Scheduler for executors.
+func NewServer(cfg *config.Configure) (*ExecutorServer, error) {
+	s, err := newExecutorServer(cfg, cfg.GetServerConfig().ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	s.scheduler = scheduler.NewScheduler(cfg.GetServerConfig())
+	schedulerpb.RegisterSchedulerServer(s.grpcServer, s.scheduler)
+	return s, nil
+}
+
+func newExecutorServer(cfg *config.Configure, listenAddr string) (*ExecutorServer, error) {
 	executorCfg := cfg.GetExecutorConfig()
 	s := &ExecutorServer{
-		grpcServer: grpc.NewServer(),
-		listenAddr: executorCfg.ListenAddr,
-		workDir:    executorCfg.WorkDir,
-		cache:      caches.GenerateCacheFromConfig(cfg.GetCacheConfig()),
+		// leave room for digests of a batch carrying max_batch_total_size bytes of blobs
+		grpcServer:  grpc.NewServer(grpc.MaxRecvMsgSize(2 * maxBatchTotalSize)),
+		listenAddr:  listenAddr,
+		workDir:     executorCfg.WorkDir,
+		cache:       caches.GenerateCacheFromConfig(cfg.GetCacheConfig()),
+		actionCache: cfg.GetActionCacheConfig(),
+		operations:  newOperationStore(),
+		logStreams:  newLogStreamStore(),
+
+		keepActionDirs:        executorCfg.KeepActionDirs,
+		linkInputs:            executorCfg.LinkInputs,
+		inputFetchConcurrency: defaultInputFetchConcurrency,
+
+		defaultActionTimeout: defaultActionTimeout,
+		maxActionTimeout:     maxActionTimeout,
+
+		platform:  platform.New(executorCfg),
+		worker:    executorCfg.GetExecutorID(),
+		admission: admission.NewFromConfig(executorCfg),
+	}
+	if executorCfg.DefaultActionTimeout > 0 {
+		s.defaultActionTimeout = time.Duration(executorCfg.DefaultActionTimeout) * time.Second
+	}
+	if executorCfg.MaxActionTimeout > 0 {
+		s.maxActionTimeout = time.Duration(executorCfg.MaxActionTimeout) * time.Second
+	}
+	if executorCfg.InputFetchConcurrency > 0 {
+		s.inputFetchConcurrency = executorCfg.InputFetchConcurrency
+	}
+	if s.defaultActionTimeout > s.maxActionTimeout {
+		s.defaultActionTimeout = s.maxActionTimeout
 	}
+	directoryCacheSize := int64(defaultDirectoryCacheSize)
+	if executorCfg.DirectoryCacheSize > 0 {
+		directoryCacheSize = executorCfg.DirectoryCacheSize
+	}
+	s.directories = newDirectoryCache(directoryCacheSize)
+	s.verifiedBlobs = newVerifiedBlobs(defaultVerifiedBlobsSize)
+	runners, err := runner.New(executorCfg)
+	if err != nil {
+		return nil, err
+	}
+	s.runners = runners
 	debugCfg := cfg.GetDebugConfig()
 	if debugCfg.LogLevel != "" {
 		lev, err := logrus.ParseLevel(debugCfg.LogLevel)
@@ -45,6 +144,7 @@ func New(cfg *config.Configure) (*ExecutorServer, error) {
 	bytestream.RegisterByteStreamServer(s.grpcServer, s)
 	repb.RegisterCapabilitiesServer(s.grpcServer, s)
 	repb.RegisterActionCacheServer(s.grpcServer, s)
+	longrunning.RegisterOperationsServer(s.grpcServer, s)
 	return s, nil
 }
 
@@ -55,9 +155,17 @@ func (s *ExecutorServer) Run() error {
 	}
 	defer lis.Close()
 	logrus.Infof("baize server remote execuotor listen at addr %s", s.listenAddr)
+	if s.scheduler != nil {
+		defer s.scheduler.Stop()
+	}
 	return s.grpcServer.Serve(lis)
 }
 
+// Stop stops serving, Run returns after requests being served completed
+func (s *ExecutorServer) Stop() {
+	s.grpcServer.GracefulStop()
+}
+
 func (s *ExecutorServer) GetCapabilities(ctx context.Context, in *repb.GetCapabilitiesRequest) (*repb.ServerCapabilities, error) {
 	logrus.Tracef("registr remote execute instance %s", in.GetInstanceName())
 	return &repb.ServerCapabilities{
@@ -73,8 +181,8 @@ func (s *ExecutorServer) GetCapabilities(ctx context.Context, in *repb.GetCapabi
 				UpdateEnabled: true,
 			},
 			// CachePriorityCapabilities: Priorities not supported.
-			// MaxBatchTotalSize: Not used by Bazel yet.
-			SymlinkAbsolutePathStrategy: repb.SymlinkAbsolutePathStrategy_ALLOWED,
+			MaxBatchTotalSizeBytes:      maxBatchTotalSize,
+			SymlinkAbsolutePathStrategy: symlinkAbsolutePathStrategy,
 		},
 		ExecutionCapabilities: &repb.ExecutionCapabilities{
 			DigestFunction: repb.DigestFunction_SHA256,
@@ -84,7 +192,7 @@ func (s *ExecutorServer) GetCapabilities(ctx context.Context, in *repb.GetCapabi
 					{MinPriority: math.MinInt32, MaxPriority: math.MaxInt32},
 				},
 			},
-			SupportedNodeProperties: nil,
+			SupportedNodeProperties: []string{"mtime", "unix_mode"},
 		},
 		LowApiVersion:        &semver.SemVer{Major: 2},
 		HighApiVersion:       &semver.SemVer{Major: 2},
@@ -0,0 +1,60 @@
+package baize
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/protobuf/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dashjay/baize/pkg/caches"
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/runner"
+	"github.com/dashjay/baize/pkg/utils"
+)
+
+func TestBaize(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "baize suite test")
+}
+
+// newTestServer returns a server executing actions on the host under workDir with blobs kept in memory,
+// specs set other fields they test on it.
+func newTestServer(workDir string) *ExecutorServer {
+	runners, err := runner.New(&config.ExecutorConfig{})
+	Expect(err).To(BeNil())
+	return &ExecutorServer{
+		cache:                 caches.NewMemoryCache(&config.Cache{Enabled: true, CacheSize: 1 << 20, UnitSizeLimitation: 1 << 20}),
+		operations:            newOperationStore(),
+		logStreams:            newLogStreamStore(),
+		workDir:               workDir,
+		inputFetchConcurrency: 2,
+		directories:           newDirectoryCache(1 << 20),
+		verifiedBlobs:         newVerifiedBlobs(16),
+		defaultActionTimeout:  time.Minute,
+		maxActionTimeout:      time.Hour,
+		runners:               runners,
+	}
+}
+
+// casOf returns the CAS of the default instance of s
+func casOf(s *ExecutorServer) interfaces.Cache {
+	cas, err := s.cache.WithIsolation(context.Background(), interfaces.CASCacheType, "")
+	Expect(err).To(BeNil())
+	return cas
+}
+
+// putProto writes m into cas and returns its digest
+func putProto(cas interfaces.Cache, m proto.Message) *repb.Digest {
+	data, err := proto.Marshal(m)
+	Expect(err).To(BeNil())
+	d := utils.CalSHA256OfInput(data)
+	Expect(cas.Set(context.Background(), d, data)).To(BeNil())
+	return d
+}
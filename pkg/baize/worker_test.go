@@ -0,0 +1,137 @@
+package baize
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/golang/protobuf/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/bytestream"
+	"google.golang.org/genproto/googleapis/longrunning"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/executor"
+	"github.com/dashjay/baize/pkg/utils"
+)
+
+var _ = Describe("test worker mode", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		dir    string
+		server *ExecutorServer
+		conn   *grpc.ClientConn
+	)
+	// newConfig returns config of a process sharing the disk cache with others
+	newConfig := func(name string) *config.Configure {
+		workDir := filepath.Join(dir, name)
+		Expect(os.MkdirAll(workDir, os.ModePerm)).To(BeNil())
+		return &config.Configure{
+			ExecutorConfig: config.ExecutorConfig{WorkDir: workDir, ExecutorID: name},
+			CacheConfig: config.CacheConfig{
+				DiskCache:     &config.Cache{Enabled: true, CacheSize: 1 << 30, CacheAddr: filepath.Join(dir, "cache")},
+				RedisCache:    &config.Cache{},
+				InmemoryCache: &config.Cache{},
+			},
+		}
+	}
+	putBlobs := func(blobs ...[]byte) {
+		var requests []*repb.BatchUpdateBlobsRequest_Request
+		for _, data := range blobs {
+			requests = append(requests, &repb.BatchUpdateBlobsRequest_Request{Digest: utils.CalSHA256OfInput(data), Data: data})
+		}
+		rsp, err := repb.NewContentAddressableStorageClient(conn).BatchUpdateBlobs(ctx, &repb.BatchUpdateBlobsRequest{Requests: requests})
+		Expect(err).To(BeNil())
+		for _, r := range rsp.GetResponses() {
+			Expect(r.GetStatus().GetCode()).To(Equal(int32(codes.OK)))
+		}
+	}
+	marshal := func(m proto.Message) []byte {
+		data, err := proto.Marshal(m)
+		Expect(err).To(BeNil())
+		return data
+	}
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "worker-mode-test-")
+		Expect(err).To(BeNil())
+		Expect(os.MkdirAll(filepath.Join(dir, "cache"), os.ModePerm)).To(BeNil())
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+
+		server, err = NewServer(newConfig("server"))
+		Expect(err).To(BeNil())
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		go server.grpcServer.Serve(lis)
+
+		cfg := newConfig("executor")
+		cfg.SchedulerAddr = lis.Addr().String()
+		worker, err := New(cfg)
+		Expect(err).To(BeNil())
+		go executor.New(cfg.GetExecutorConfig(), worker).Run(ctx)
+
+		conn, err = grpc.DialContext(ctx, lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		cancel()
+		Expect(conn.Close()).To(BeNil())
+		server.grpcServer.Stop()
+		server.scheduler.Stop()
+		Expect(os.RemoveAll(dir)).To(BeNil())
+	})
+	It("run actions uploaded to the server by the executor", func() {
+		input := []byte("input")
+		inputRoot := marshal(&repb.Directory{Files: []*repb.FileNode{{Name: "in", Digest: utils.CalSHA256OfInput(input)}}})
+		command := marshal(&repb.Command{Arguments: []string{"sh", "-c", "cat in > out && echo hello"}, OutputFiles: []string{"out"}})
+		action := marshal(&repb.Action{CommandDigest: utils.CalSHA256OfInput(command), InputRootDigest: utils.CalSHA256OfInput(inputRoot)})
+		putBlobs(input, inputRoot, command, action)
+
+		stream, err := repb.NewExecutionClient(conn).Execute(ctx, &repb.ExecuteRequest{ActionDigest: utils.CalSHA256OfInput(action)})
+		Expect(err).To(BeNil())
+		var op *longrunning.Operation
+		for op == nil || !op.GetDone() {
+			op, err = stream.Recv()
+			Expect(err).To(BeNil())
+		}
+		eom := &repb.ExecuteOperationMetadata{}
+		Expect(op.GetMetadata().UnmarshalTo(eom)).To(BeNil())
+		rsp := &repb.ExecuteResponse{}
+		Expect(op.GetResponse().UnmarshalTo(rsp)).To(BeNil())
+		Expect(rsp.GetStatus().GetCode()).To(Equal(int32(codes.OK)))
+		Expect(rsp.GetResult().GetExitCode()).To(Equal(int32(0)))
+		Expect(rsp.GetResult().GetExecutionMetadata().GetWorker()).To(Equal("executor"))
+		Expect(rsp.GetResult().GetOutputFiles()).To(HaveLen(1))
+		Expect(rsp.GetResult().GetOutputFiles()[0].GetDigest()).To(Equal(utils.CalSHA256OfInput(input)))
+
+		read, err := repb.NewContentAddressableStorageClient(conn).BatchReadBlobs(ctx, &repb.BatchReadBlobsRequest{
+			Digests: []*repb.Digest{rsp.GetResult().GetStdoutDigest()},
+		})
+		Expect(err).To(BeNil())
+		Expect(string(read.GetResponses()[0].GetData())).To(Equal("hello\n"))
+
+		// outputs forwarded by the executor are served by the server as well
+		logs, err := bytestream.NewByteStreamClient(conn).Read(ctx, &bytestream.ReadRequest{ResourceName: eom.GetStdoutStreamName()})
+		Expect(err).To(BeNil())
+		var stdout []byte
+		for {
+			chunk, err := logs.Recv()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).To(BeNil())
+			stdout = append(stdout, chunk.GetData()...)
+		}
+		Expect(string(stdout)).To(Equal("hello\n"))
+	})
+})
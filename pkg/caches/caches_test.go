@@ -12,6 +12,7 @@ import (
 	"github.com/dashjay/baize/pkg/config"
 	"github.com/dashjay/baize/pkg/interfaces"
 	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/status"
 )
 
 const defaultRandomBytesSize = 200
@@ -138,4 +139,164 @@ func RunAllTest(ctx context.Context) {
 		Expect(r.Close()).To(BeNil())
 		Expect(content).To(Equal(content))
 	})
+	It("Abort keeps the blob stored under the digest", func() {
+		src := utils.RandomBytes(defaultRandomBytesSize)
+		digest := utils.CalSHA256OfInput(src)
+		Expect(cache.Set(ctx, digest, src)).To(BeNil())
+		w, err := cache.Writer(ctx, digest)
+		Expect(err).To(BeNil())
+		_, err = w.Write(src[:defaultRandomBytesSize/2])
+		Expect(err).To(BeNil())
+		Expect(w.Abort()).To(BeNil())
+		got, err := cache.Get(ctx, digest)
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(src))
+	})
 }
+
+var _ = Describe("test local file cache", func() {
+	var (
+		ctx     = context.Background()
+		tempdir string
+		local   interfaces.LocalFileCache
+		c       interfaces.Cache
+	)
+	BeforeEach(func() {
+		var err error
+		tempdir, err = ioutil.TempDir(os.TempDir(), "")
+		Expect(err).To(BeNil())
+		disk := NewDiskCache(&config.Cache{Enabled: true, CacheSize: 65535, CacheAddr: tempdir})
+		c = NewComposedCache(disk, NewMemoryCache(&config.Cache{CacheSize: 65535}), ModeReadThrough|ModeWriteThrough)
+		c, err = c.WithIsolation(ctx, interfaces.CASCacheType, "")
+		Expect(err).To(BeNil())
+		local = c.(interfaces.LocalFileCache)
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempdir)).To(BeNil())
+	})
+	It("acquire missing blob", func() {
+		_, _, err := local.Acquire(ctx, utils.CalSHA256OfInput([]byte("missing")))
+		Expect(status.IsNotFoundError(err)).To(BeTrue())
+	})
+	It("remove pinned file after released", func() {
+		src := utils.RandomBytes(defaultRandomBytesSize)
+		d := utils.CalSHA256OfInput(src)
+		Expect(c.Set(ctx, d, src)).To(BeNil())
+		path, release, err := local.Acquire(ctx, d)
+		Expect(err).To(BeNil())
+		content, err := ioutil.ReadFile(path)
+		Expect(err).To(BeNil())
+		Expect(content).To(Equal(src))
+
+		Expect(c.Delete(ctx, d)).To(BeNil())
+		_, err = os.Stat(path)
+		Expect(err).To(BeNil())
+		release()
+		_, err = os.Stat(path)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+	It("never find files evicted while pinned", func() {
+		src := utils.RandomBytes(defaultRandomBytesSize)
+		d := utils.CalSHA256OfInput(src)
+		Expect(c.Set(ctx, d, src)).To(BeNil())
+		path, release, err := local.Acquire(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(c.Delete(ctx, d)).To(BeNil())
+		exists, err := c.Contains(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeFalse())
+		release()
+		_, err = os.Stat(path)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		exists, err = c.Contains(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeFalse())
+	})
+	It("keep file written again while pinned", func() {
+		src := utils.RandomBytes(defaultRandomBytesSize)
+		d := utils.CalSHA256OfInput(src)
+		Expect(c.Set(ctx, d, src)).To(BeNil())
+		path, release, err := local.Acquire(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(c.Delete(ctx, d)).To(BeNil())
+		Expect(c.Set(ctx, d, src)).To(BeNil())
+		release()
+		_, err = os.Stat(path)
+		Expect(err).To(BeNil())
+	})
+	It("find blobs written by another disk cache sharing the root dir", func() {
+		other, err := NewDiskCache(&config.Cache{Enabled: true, CacheSize: 65535, CacheAddr: tempdir}).WithIsolation(ctx, interfaces.CASCacheType, "")
+		Expect(err).To(BeNil())
+		src := utils.RandomBytes(defaultRandomBytesSize)
+		d := utils.CalSHA256OfInput(src)
+		Expect(c.Set(ctx, d, src)).To(BeNil())
+		missing, err := other.FindMissing(ctx, []*repb.Digest{d})
+		Expect(err).To(BeNil())
+		Expect(missing).To(BeEmpty())
+		content, err := other.Get(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(content).To(Equal(src))
+		path, release, err := other.(interfaces.LocalFileCache).Acquire(ctx, d)
+		Expect(err).To(BeNil())
+		release()
+		Expect(other.Delete(ctx, d)).To(BeNil())
+		_, err = os.Stat(path)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("test blobs over cutoff size", func() {
+	var (
+		ctx     = context.Background()
+		tempdir string
+		c       interfaces.Cache
+	)
+	BeforeEach(func() {
+		var err error
+		tempdir, err = ioutil.TempDir(os.TempDir(), "")
+		Expect(err).To(BeNil())
+		inner := NewMemoryCache(&config.Cache{CacheSize: 65535, UnitSizeLimitation: 16})
+		outer := NewDiskCache(&config.Cache{Enabled: true, CacheSize: 65535, CacheAddr: tempdir})
+		c, err = NewComposedCache(inner, outer, ModeReadThrough|ModeWriteThrough).WithIsolation(ctx, interfaces.CASCacheType, "")
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempdir)).To(BeNil())
+	})
+	It("route blobs to the cache accepting them", func() {
+		Expect(c.MaxBlobSize()).To(BeNumerically(">", 16))
+		src := utils.RandomBytes(defaultRandomBytesSize)
+		d := utils.CalSHA256OfInput(src)
+		Expect(c.Set(ctx, d, src)).To(BeNil())
+		content, err := c.Get(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(content).To(Equal(src))
+
+		src = utils.RandomBytes(defaultRandomBytesSize)
+		d = utils.CalSHA256OfInput(src)
+		w, err := c.Writer(ctx, d)
+		Expect(err).To(BeNil())
+		_, err = w.Write(src)
+		Expect(err).To(BeNil())
+		Expect(w.Close()).To(BeNil())
+		content, err = c.Get(ctx, d)
+		Expect(err).To(BeNil())
+		Expect(content).To(Equal(src))
+	})
+	It("delete blobs stored in outer cache only", func() {
+		src := utils.RandomBytes(defaultRandomBytesSize)
+		d := utils.CalSHA256OfInput(src)
+		Expect(c.Set(ctx, d, src)).To(BeNil())
+		Expect(c.Delete(ctx, d)).To(BeNil())
+		_, err := c.Get(ctx, d)
+		Expect(status.IsNotFoundError(err)).To(BeTrue())
+	})
+	It("reject blobs over cutoff of all caches", func() {
+		disk := NewDiskCache(&config.Cache{Enabled: true, CacheSize: 65535, CacheAddr: tempdir, UnitSizeLimitation: 16})
+		src := utils.RandomBytes(defaultRandomBytesSize)
+		d := utils.CalSHA256OfInput(src)
+		Expect(disk.Set(ctx, d, src)).NotTo(BeNil())
+		_, err := disk.Writer(ctx, d)
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -74,6 +74,19 @@ func (c *ComposedCache) Size() int64 {
 	return c.inner.Size() + c.outer.Size()
 }
 
+// MaxBlobSize is the larger one of inner and outer, blobs over the cutoff of
+// inner one are routed to outer one.
+func (c *ComposedCache) MaxBlobSize() int64 {
+	if c.outer.MaxBlobSize() > c.inner.MaxBlobSize() {
+		return c.outer.MaxBlobSize()
+	}
+	return c.inner.MaxBlobSize()
+}
+
+func fits(cache interfaces.Cache, size int64) bool {
+	return size <= cache.MaxBlobSize()
+}
+
 func NewComposedCache(inner, outer interfaces.Cache, mode CacheMode) interfaces.Cache {
 	return &ComposedCache{
 		inner: inner,
@@ -147,31 +160,54 @@ func (c *ComposedCache) GetMulti(ctx context.Context, digests []*repb.Digest) (m
 }
 
 func (c *ComposedCache) Set(ctx context.Context, d *repb.Digest, data []byte) error {
+	size := int64(len(data))
+	if !fits(c.inner, size) && fits(c.outer, size) {
+		return c.outer.Set(ctx, d, data)
+	}
 	if err := c.inner.Set(ctx, d, data); err != nil {
 		return err
 	}
-	if c.mode&ModeWriteThrough != 0 {
+	if c.mode&ModeWriteThrough != 0 && fits(c.outer, size) {
 		c.outer.Set(ctx, d, data)
 	}
 	return nil
 }
 
 func (c *ComposedCache) SetMulti(ctx context.Context, kvs map[*repb.Digest][]byte) error {
-	if err := c.inner.SetMulti(ctx, kvs); err != nil {
+	innerKvs := make(map[*repb.Digest][]byte, len(kvs))
+	outerKvs := make(map[*repb.Digest][]byte)
+	for d, data := range kvs {
+		if !fits(c.inner, int64(len(data))) && fits(c.outer, int64(len(data))) {
+			outerKvs[d] = data
+		} else {
+			innerKvs[d] = data
+		}
+	}
+	if err := c.outer.SetMulti(ctx, outerKvs); err != nil {
+		return err
+	}
+	if err := c.inner.SetMulti(ctx, innerKvs); err != nil {
 		return err
 	}
 	if c.mode&ModeWriteThrough != 0 {
-		c.outer.SetMulti(ctx, kvs)
+		throughKvs := make(map[*repb.Digest][]byte, len(innerKvs))
+		for d, data := range innerKvs {
+			if fits(c.outer, int64(len(data))) {
+				throughKvs[d] = data
+			}
+		}
+		c.outer.SetMulti(ctx, throughKvs)
 	}
 	return nil
 }
 
+// Delete removes the blob from both caches, blobs over the cutoff of inner one are only in outer one.
+// It fails only if the blob could be removed from neither.
 func (c *ComposedCache) Delete(ctx context.Context, d *repb.Digest) error {
-	if err := c.inner.Delete(ctx, d); err != nil {
-		return err
-	}
-	if c.mode&ModeWriteThrough != 0 {
-		c.outer.Delete(ctx, d)
+	innerErr := c.inner.Delete(ctx, d)
+	outerErr := c.outer.Delete(ctx, d)
+	if innerErr != nil && outerErr != nil {
+		return innerErr
 	}
 	return nil
 }
@@ -186,7 +222,7 @@ func (c *ComposedCache) Reader(ctx context.Context, d *repb.Digest, offset int64
 		return nil, err
 	}
 
-	if c.mode&ModeReadThrough != 0 && offset == 0 {
+	if c.mode&ModeReadThrough != 0 && offset == 0 && fits(c.outer, d.GetSizeBytes()) {
 		if outerWriter, err := c.outer.Writer(ctx, d); err == nil {
 			tr := &ReadCloser{
 				io.TeeReader(innerReader, outerWriter),
@@ -199,13 +235,16 @@ func (c *ComposedCache) Reader(ctx context.Context, d *repb.Digest, offset int64
 	return innerReader, nil
 }
 
-func (c *ComposedCache) Writer(ctx context.Context, d *repb.Digest) (io.WriteCloser, error) {
+func (c *ComposedCache) Writer(ctx context.Context, d *repb.Digest) (interfaces.BlobWriter, error) {
+	if !fits(c.inner, d.GetSizeBytes()) && fits(c.outer, d.GetSizeBytes()) {
+		return c.outer.Writer(ctx, d)
+	}
 	innerWriter, err := c.inner.Writer(ctx, d)
 	if err != nil {
 		return nil, err
 	}
 
-	if c.mode&ModeWriteThrough != 0 {
+	if c.mode&ModeWriteThrough != 0 && fits(c.outer, d.GetSizeBytes()) {
 		if outerWriter, err := c.outer.Writer(ctx, d); err == nil {
 			dw := &doubleWriter{
 				inner: innerWriter,
@@ -223,11 +262,28 @@ func (c *ComposedCache) Writer(ctx context.Context, d *repb.Digest) (io.WriteClo
 	return innerWriter, nil
 }
 
+// Acquire acquires the blob from the inner or outer cache which keeps files on local disk
+func (c *ComposedCache) Acquire(ctx context.Context, d *repb.Digest) (string, func(), error) {
+	for _, cache := range []interfaces.Cache{c.inner, c.outer} {
+		if local, ok := cache.(interfaces.LocalFileCache); ok {
+			path, release, err := local.Acquire(ctx, d)
+			if err == nil {
+				return path, release, nil
+			}
+			if !status.IsNotFoundError(err) {
+				return "", nil, err
+			}
+		}
+	}
+	return "", nil, status.NotFoundErrorf("key %s not exists in local file cache", d.GetHash())
+}
+
 var _ interfaces.Cache = (*ComposedCache)(nil)
+var _ interfaces.LocalFileCache = (*ComposedCache)(nil)
 
 type doubleWriter struct {
-	inner   io.WriteCloser
-	outer   io.WriteCloser
+	inner   interfaces.BlobWriter
+	outer   interfaces.BlobWriter
 	closeFn func(err error)
 }
 
@@ -249,6 +305,11 @@ func (d *doubleWriter) Close() error {
 	return err
 }
 
+func (d *doubleWriter) Abort() error {
+	d.outer.Abort()
+	return d.inner.Abort()
+}
+
 type ReadCloser struct {
 	io.Reader
 	io.Closer
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dashjay/baize/pkg/interfaces"
@@ -48,6 +49,65 @@ type DiskCache struct {
 	unitSizeLimitation          int
 	instanceName                string
 	cacheType                   interfaces.CacheType
+	// pins holds files acquired by executors
+	pins *pinSet
+}
+
+// pinSet counts references of files acquired by executors, removing of
+// files in use is deferred until they are released.
+type pinSet struct {
+	mu      sync.Mutex
+	refs    map[string]int
+	evicted map[string]bool
+}
+
+func newPinSet() *pinSet {
+	return &pinSet{refs: make(map[string]int), evicted: make(map[string]bool)}
+}
+
+func (p *pinSet) acquire(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refs[key]++
+}
+
+// release returns true if the file was evicted while pinned and should be removed now
+func (p *pinSet) release(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refs[key]--
+	if p.refs[key] > 0 {
+		return false
+	}
+	delete(p.refs, key)
+	evicted := p.evicted[key]
+	delete(p.evicted, key)
+	return evicted
+}
+
+// deferRemoval returns true if the file is pinned, it will be removed on release
+func (p *pinSet) deferRemoval(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refs[key] == 0 {
+		return false
+	}
+	p.evicted[key] = true
+	return true
+}
+
+// isEvicted returns true if the file was removed from lru while pinned
+func (p *pinSet) isEvicted(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.evicted[key]
+}
+
+// rewritten cancels the deferred removal, for the file is written again
+func (p *pinSet) rewritten(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.evicted, key)
 }
 
 func (c *DiskCache) WithIsolation(ctx context.Context, cacheType interfaces.CacheType, remoteInstanceName string) (interfaces.Cache, error) {
@@ -59,6 +119,7 @@ func (c *DiskCache) WithIsolation(ctx context.Context, cacheType interfaces.Cach
 		instanceName:       remoteInstanceName,
 		cacheType:          cacheType,
 		metrics:            c.metrics,
+		pins:               c.pins,
 	}, nil
 }
 
@@ -119,6 +180,7 @@ func NewDiskCache(cfg *config.Cache) interfaces.Cache {
 		metrics:                     &Metrics{},
 		finishLoadingFromFileSystem: make(chan struct{}),
 		unitSizeLimitation:          usl,
+		pins:                        newPinSet(),
 	}
 
 	l, err := lru.NewLRU(&lru.Config{
@@ -182,18 +244,26 @@ func (c *DiskCache) loadingFromFileSystem() {
 // it will delete the file from disk
 func (c *DiskCache) onRemove(value interface{}) {
 	if v, ok := value.(*fileRecord); ok {
-		fullPath := filepath.Join(c.rootDir, v.key)
-		_, err := os.Stat(fullPath)
-		if err != nil {
-			logrus.Errorf("try to remove file %s error: %s", fullPath, err)
+		if c.pins.deferRemoval(v.key) {
+			logrus.Tracef("file %s in use, remove it on release", v.key)
 			return
 		}
-		err = os.Remove(fullPath)
-		if err != nil {
-			logrus.Errorf("try to remove file %s error: %s", fullPath, err)
-		} else {
-			logrus.Tracef("remove file %s success", fullPath)
-		}
+		c.removeFile(v.key)
+	}
+}
+
+func (c *DiskCache) removeFile(key string) {
+	fullPath := filepath.Join(c.rootDir, key)
+	_, err := os.Stat(fullPath)
+	if err != nil {
+		logrus.Errorf("try to remove file %s error: %s", fullPath, err)
+		return
+	}
+	err = os.Remove(fullPath)
+	if err != nil {
+		logrus.Errorf("try to remove file %s error: %s", fullPath, err)
+	} else {
+		logrus.Tracef("remove file %s success", fullPath)
 	}
 }
 
@@ -205,13 +275,34 @@ func (c *DiskCache) sizeFn(value interface{}) int64 {
 	return 0
 }
 
-// Contains only call lru
+// contains looks up key in lru, files not in lru are looked up on disk,
+// since processes sharing rootDir, e.g. baize-server and its executors, index files written by others
+// only at startup. Files found on disk are added to lru, except files evicted but kept until released.
+func (c *DiskCache) contains(key string) bool {
+	if c.lru.Contains(key) {
+		return true
+	}
+	if c.pins.isEvicted(key) {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(c.rootDir, key))
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	return c.lru.Add(key, &fileRecord{
+		lastUseTime: fi.ModTime().Unix(),
+		key:         key,
+		sizeBytes:   fi.Size(),
+	})
+}
+
+// Contains looks up lru, then the disk
 func (c *DiskCache) Contains(ctx context.Context, d *repb.Digest) (bool, error) {
 	key, err := c.key(d)
 	if err != nil {
 		return false, err
 	}
-	return c.lru.Contains(key), nil
+	return c.contains(key), nil
 }
 
 func (c *DiskCache) FindMissing(ctx context.Context, digests []*repb.Digest) ([]*repb.Digest, error) {
@@ -230,8 +321,7 @@ func (c *DiskCache) Get(ctx context.Context, d *repb.Digest) ([]byte, error) {
 		return nil, err
 	}
 	errNotExists := status.NotFoundErrorf("key %s not exists", key)
-	_, exists := c.lru.Get(key)
-	if !exists {
+	if !c.contains(key) {
 		c.metrics.Miss()
 		return nil, errNotExists
 	}
@@ -270,6 +360,7 @@ func (c *DiskCache) Set(ctx context.Context, d *repb.Digest, data []byte) error
 	if len(data) > c.unitSizeLimitation {
 		return errByteSizeOverCutoffSize
 	}
+	c.pins.rewritten(key)
 	v, exists := c.lru.Get(key)
 	if exists && v.(*fileRecord).sizeBytes == int64(len(data)) {
 		return nil
@@ -303,7 +394,7 @@ func (c *DiskCache) Delete(ctx context.Context, d *repb.Digest) error {
 	if err != nil {
 		return err
 	}
-	if !c.lru.Remove(key) {
+	if !c.contains(key) || !c.lru.Remove(key) {
 		return status.InternalErrorf("remove %s fail", d.GetHash())
 	}
 	return nil
@@ -329,36 +420,40 @@ func (c *DiskCache) Reader(ctx context.Context, d *repb.Digest, offset int64) (i
 type dbCloseFn func(totalBytesWritten int64) error
 
 type dbWriteOnClose struct {
-	io.WriteCloser
+	interfaces.BlobWriter
 	closeFn      dbCloseFn
 	bytesWritten int64
 }
 
 func (d *dbWriteOnClose) Write(data []byte) (int, error) {
-	n, err := d.WriteCloser.Write(data)
+	n, err := d.BlobWriter.Write(data)
 	d.bytesWritten += int64(n)
 	return n, err
 }
 
 func (d *dbWriteOnClose) Close() error {
-	if err := d.WriteCloser.Close(); err != nil {
+	if err := d.BlobWriter.Close(); err != nil {
 		return err
 	}
 	return d.closeFn(d.bytesWritten)
 }
 
-func (c *DiskCache) Writer(ctx context.Context, d *repb.Digest) (io.WriteCloser, error) {
+func (c *DiskCache) Writer(ctx context.Context, d *repb.Digest) (interfaces.BlobWriter, error) {
 	key, err := c.key(d)
 	if err != nil {
 		return nil, err
 	}
+	if d.GetSizeBytes() > c.MaxBlobSize() {
+		return nil, errByteSizeOverCutoffSize
+	}
 	fullPath := filepath.Join(c.rootDir, key)
+	c.pins.rewritten(key)
 	writeCloser, err := disk.FileWriter(ctx, fullPath)
 	if err != nil {
 		return nil, err
 	}
 	return &dbWriteOnClose{
-		WriteCloser: writeCloser,
+		BlobWriter: writeCloser,
 		closeFn: func(totalBytesWritten int64) error {
 			c.lru.Add(key, &fileRecord{
 				lastUseTime: time.Now().Unix(),
@@ -370,4 +465,33 @@ func (c *DiskCache) Writer(ctx context.Context, d *repb.Digest) (io.WriteCloser,
 	}, nil
 }
 
+func (c *DiskCache) MaxBlobSize() int64 {
+	return int64(c.unitSizeLimitation)
+}
+
+// Acquire returns path of the blob on disk, the file will not be removed until release is called
+func (c *DiskCache) Acquire(ctx context.Context, d *repb.Digest) (string, func(), error) {
+	key, err := c.key(d)
+	if err != nil {
+		return "", nil, err
+	}
+	c.pins.acquire(key)
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if c.pins.release(key) {
+				c.removeFile(key)
+			}
+		})
+	}
+	if !c.contains(key) {
+		release()
+		c.metrics.Miss()
+		return "", nil, status.NotFoundErrorf("key %s not exists", d.GetHash())
+	}
+	c.metrics.Hit()
+	return filepath.Join(c.rootDir, key), release, nil
+}
+
 var _ interfaces.Cache = (*DiskCache)(nil)
+var _ interfaces.LocalFileCache = (*DiskCache)(nil)
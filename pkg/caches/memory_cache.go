@@ -193,7 +193,7 @@ func (m *MemoryCache) Reader(ctx context.Context, d *repb.Digest, offset int64)
 	return io.NopCloser(r), nil
 }
 
-func (m *MemoryCache) Writer(ctx context.Context, d *repb.Digest) (io.WriteCloser, error) {
+func (m *MemoryCache) Writer(ctx context.Context, d *repb.Digest) (interfaces.BlobWriter, error) {
 	_, err := m.key(d)
 	if err != nil {
 		return nil, err
@@ -210,6 +210,10 @@ func (m *MemoryCache) Writer(ctx context.Context, d *repb.Digest) (io.WriteClose
 	}, nil
 }
 
+func (m *MemoryCache) MaxBlobSize() int64 {
+	return int64(m.unitSizeLimitation)
+}
+
 var _ interfaces.Cache = (*MemoryCache)(nil)
 
 type closeFn func(b *bytes.Buffer) error
@@ -222,3 +226,9 @@ type setOnClose struct {
 func (d *setOnClose) Close() error {
 	return d.c(d.Buffer)
 }
+
+// Abort drops the buffer without setting it
+func (d *setOnClose) Abort() error {
+	d.Buffer.Reset()
+	return nil
+}
@@ -194,7 +194,7 @@ func (r *RedisCache) Reader(ctx context.Context, d *repb.Digest, offset int64) (
 	return io.NopCloser(br), nil
 }
 
-func (r *RedisCache) Writer(ctx context.Context, d *repb.Digest) (io.WriteCloser, error) {
+func (r *RedisCache) Writer(ctx context.Context, d *repb.Digest) (interfaces.BlobWriter, error) {
 	_, err := r.key(d)
 	if err != nil {
 		return nil, err
@@ -208,4 +208,8 @@ func (r *RedisCache) Writer(ctx context.Context, d *repb.Digest) (io.WriteCloser
 	}, nil
 }
 
+func (r *RedisCache) MaxBlobSize() int64 {
+	return int64(r.unitSizeLimitation)
+}
+
 var _ interfaces.Cache = (*RedisCache)(nil)
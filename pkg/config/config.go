@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/BurntSushi/toml"
 	"github.com/sirupsen/logrus"
@@ -13,12 +14,107 @@ type DebugConfig struct {
 type ServerConfig struct {
 	ListenAddr string `toml:"listen_addr"`
 	PprofAddr  string `toml:"pprof_addr"`
+
+	// HeartBeatTimeout is seconds an executor will be considered dead since its last heartbeat
+	HeartBeatTimeout int `toml:"heartbeat_timeout"`
+	// MaxJobRetries is how many times a job failed by its executor, e.g. the executor is lost or hits an I/O error,
+	// is run again on another executor. 2 is used if 0, negative value disables retries.
+	MaxJobRetries int `toml:"max_job_retries"`
 }
 
 type ExecutorConfig struct {
 	ListenAddr string `toml:"listen_addr"`
 	PprofAddr  string `toml:"pprof_addr"`
 	WorkDir    string `toml:"work_dir"`
+	// KeepActionDirs keeps the directory of every action under work_dir for debugging
+	KeepActionDirs bool `toml:"keep_action_dirs"`
+	// LinkInputs hardlinks input files from disk cache instead of copying them, work_dir should be on the
+	// same filesystem as disk cache. Only enable it if actions can not write the inputs, e.g. they run as
+	// another user or the exec root is bind mounted read-only, since they share the inode with the cache.
+	// Blobs are still verified before being linked again and removed if they were changed.
+	LinkInputs bool `toml:"link_inputs"`
+	// InputFetchConcurrency is the max number of input files downloaded at the same time for an action
+	InputFetchConcurrency int `toml:"input_fetch_concurrency"`
+	// DirectoryCacheSize is bytes of Directory protos of input trees kept in memory
+	DirectoryCacheSize int64 `toml:"directory_cache_size"`
+
+	// SchedulerAddr is the address of baize-server, executor works in worker mode
+	// and pulls jobs from the scheduler if it is set.
+	SchedulerAddr string `toml:"scheduler_addr"`
+	// ExecutorID identifies the executor to the scheduler, hostname is used if empty
+	ExecutorID string `toml:"executor_id"`
+	// HeartBeatInterval is seconds between two heartbeats to the scheduler
+	HeartBeatInterval int `toml:"heartbeat_interval"`
+
+	// DefaultActionTimeout is seconds an action can run if Action.timeout is not set
+	DefaultActionTimeout int `toml:"default_action_timeout"`
+	// MaxActionTimeout is the max seconds of Action.timeout, longer ones are rejected
+	MaxActionTimeout int `toml:"max_action_timeout"`
+
+	// CPUSlots is the number of CPUs shared by running actions, the number of CPUs of the host is used if 0.
+	// An action takes as many slots as its cpu platform property, 1 if not set.
+	CPUSlots int `toml:"cpu_slots"`
+	// MemoryBudgetBytes is bytes of memory shared by running actions, total memory of the host is used if 0.
+	// An action takes bytes of its mem platform property, e.g. mem=4G, or default_action_memory_bytes if not set.
+	MemoryBudgetBytes int64 `toml:"memory_budget_bytes"`
+	// DefaultActionMemoryBytes is bytes of memory taken by an action without mem platform property
+	DefaultActionMemoryBytes int64 `toml:"default_action_memory_bytes"`
+
+	// Platform holds platform properties of the executor, e.g. OSFamily, ISA, container-image and Pool.
+	// Only actions whose platform properties are all declared here with the same value are run by the executor,
+	// value "*" accepts any value. OSFamily and ISA of the host are used if not declared, container-image is
+	// declared "*" if ContainerRuntime is set, and dockerNetwork "*" if ContainerRuntime is set or Sandbox enabled.
+	Platform map[string]string `toml:"platform"`
+
+	// ContainerRuntime runs actions with container-image platform property, one of docker, podman, runc and crun.
+	// Actions requiring container-image are rejected if it is empty. For docker and podman, work_dir should be
+	// at the same path for the daemon, e.g. mounted at the same path if the executor runs in a container.
+	ContainerRuntime string `toml:"container_runtime"`
+	// RootfsDir holds root filesystems of images unpacked for runc and crun, e.g. rootfs of
+	// docker://ubuntu:20.04 is expected at <rootfs_dir>/ubuntu:20.04
+	RootfsDir string `toml:"rootfs_dir"`
+
+	// Sandbox runs actions without container-image in Linux namespaces and cgroups
+	Sandbox *SandboxConfig `toml:"sandbox"`
+}
+
+// SandboxConfig isolates actions run on the host, every action is run in new user, mount, pid, ipc, uts
+// and network namespaces and only sees its exec root and read-only system directories of the host.
+// Actions have no network unless their dockerNetwork platform property is standard.
+type SandboxConfig struct {
+	// Enabled if actions are run in sandboxes
+	Enabled bool `toml:"enabled"`
+	// CgroupDir is the cgroup v2 directory under which a cgroup is created for every action, e.g. /sys/fs/cgroup/baize.
+	// cpu and memory controllers should be available to it, CPU and memory are not limited if empty.
+	CgroupDir string `toml:"cgroup_dir"`
+	// CPUs is the max number of CPUs an action can use, 0 means unlimited
+	CPUs float64 `toml:"cpus"`
+	// MemoryBytes is the max bytes of memory an action can use, the action is killed if exceeded, 0 means unlimited
+	MemoryBytes int64 `toml:"memory_bytes"`
+}
+
+// ActionCachePolicy decides which results of executed actions are stored in the action cache,
+// results of actions with do_not_cache are never stored.
+type ActionCachePolicy struct {
+	// CacheFailures stores results of actions exited with non-zero code
+	CacheFailures bool `toml:"cache_failures"`
+	// FailureTTL is seconds a cached failure is served since the action completed, 0 means until evicted
+	FailureTTL int `toml:"failure_ttl"`
+}
+
+type ActionCacheConfig struct {
+	// Default is the policy of instances not in Instances
+	Default ActionCachePolicy `toml:"default"`
+	// Instances holds policies by instance name
+	Instances map[string]ActionCachePolicy `toml:"instances"`
+}
+
+// Policy returns the action cache policy of instance
+func (c *ActionCacheConfig) Policy(instanceName string) ActionCachePolicy {
+	if p, exists := c.Instances[instanceName]; exists {
+		return p
+	}
+	return c.Default
 }
 
 type CacheConfig struct {
@@ -46,15 +142,25 @@ type Cache struct {
 	UnitSizeLimitation int `toml:"unit_size_limitation"`
 }
 
+// GetExecutorID returns executor_id, hostname is used if it is empty
+func (c *ExecutorConfig) GetExecutorID() string {
+	if c.ExecutorID != "" {
+		return c.ExecutorID
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
 func (c *Cache) String() string {
 	return fmt.Sprintf("%#v", *c)
 }
 
 type Configure struct {
-	ExecutorConfig `toml:"executor"`
-	ServerConfig   `toml:"server"`
-	DebugConfig    `toml:"debug"`
-	CacheConfig    `toml:"caches"`
+	ExecutorConfig    `toml:"executor"`
+	ServerConfig      `toml:"server"`
+	DebugConfig       `toml:"debug"`
+	CacheConfig       `toml:"caches"`
+	ActionCacheConfig `toml:"action_cache"`
 }
 
 func (c *CacheConfig) String() string {
@@ -62,13 +168,17 @@ func (c *CacheConfig) String() string {
 }
 
 func (c *Configure) String() string {
-	return fmt.Sprintf("%#v\n%#v\n%s\n", c.DebugConfig, c.ExecutorConfig, c.CacheConfig.String())
+	return fmt.Sprintf("%#v\n%#v\n%#v\n%s\n%#v\n", c.DebugConfig, c.ServerConfig, c.ExecutorConfig, c.CacheConfig.String(), c.ActionCacheConfig)
 }
 
 func (c *Configure) GetCacheConfig() *CacheConfig {
 	return &c.CacheConfig
 }
 
+func (c *Configure) GetActionCacheConfig() *ActionCacheConfig {
+	return &c.ActionCacheConfig
+}
+
 func (c *Configure) GetExecutorConfig() *ExecutorConfig {
 	return &c.ExecutorConfig
 }
@@ -112,19 +112,20 @@ func FileReader(ctx context.Context, fullPath string, offset, length int64) (io.
 	return &readCloser{io.NewSectionReader(f, offset, info.Size()-offset), f, ctx}, nil
 }
 
-type writeMover struct {
+// WriteMover writes into a temp file, which is moved to the final path on Close or removed on Abort
+type WriteMover struct {
 	*os.File
 	ctx       context.Context
 	finalPath string
 }
 
-func (w *writeMover) Write(p []byte) (int, error) {
+func (w *WriteMover) Write(p []byte) (int, error) {
 	//_, spn := tracing.StartSpan(w.ctx)
 	//defer spn.End()
 	return w.File.Write(p)
 }
 
-func (w *writeMover) Close() error {
+func (w *WriteMover) Close() error {
 	tmpName := w.File.Name()
 	if err := w.File.Close(); err != nil {
 		return err
@@ -132,7 +133,15 @@ func (w *writeMover) Close() error {
 	return os.Rename(tmpName, w.finalPath)
 }
 
-func FileWriter(ctx context.Context, fullPath string) (io.WriteCloser, error) {
+// Abort removes the temp file and leaves the final path untouched
+func (w *WriteMover) Abort() error {
+	tmpName := w.File.Name()
+	err := w.File.Close()
+	DeleteLocalFileIfExists(tmpName)
+	return err
+}
+
+func FileWriter(ctx context.Context, fullPath string) (*WriteMover, error) {
 	if err := EnsureDirectoryExists(filepath.Dir(fullPath)); err != nil {
 		return nil, err
 	}
@@ -146,13 +155,13 @@ func FileWriter(ctx context.Context, fullPath string) (io.WriteCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	wm := &writeMover{
+	wm := &WriteMover{
 		File:      f,
 		ctx:       ctx,
 		finalPath: fullPath,
 	}
 	// Ensure that the temp file is cleaned up here too!
-	runtime.SetFinalizer(wm, func(m *writeMover) {
+	runtime.SetFinalizer(wm, func(m *WriteMover) {
 		DeleteLocalFileIfExists(tmpFileName)
 	})
 	return wm, nil
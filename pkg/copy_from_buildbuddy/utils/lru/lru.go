@@ -30,8 +30,10 @@ type Config struct {
 	MaxSize int64
 }
 
-// LRU implements a non-thread safe fixed size LRU cache
+// LRU implements a thread safe fixed size LRU cache
 type LRU struct {
+	// mu guards evictList and currentSize, items is guarded by itemsLock
+	mu          sync.Mutex
 	sizeFn      SizeFn
 	evictList   *list.List
 	items       map[uint64][]*list.Element
@@ -93,6 +95,8 @@ func (c *LRU) Metrics() string {
 
 // Purge is used to completely clear the cache.
 func (c *LRU) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.itemsLock.Lock()
 	defer c.itemsLock.Unlock()
 	for k, vals := range c.items {
@@ -108,6 +112,8 @@ func (c *LRU) Purge() {
 
 // Add adds a value to the cache. Returns true if the key was added.
 func (c *LRU) Add(key, value interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	pk, ck, ok := c.keyHash(key)
 	if !ok {
 		return false
@@ -130,6 +136,8 @@ func (c *LRU) Add(key, value interface{}) bool {
 
 // PushBack adds a value to the back of the cache. Returns true if the key was added.
 func (c *LRU) PushBack(key, value interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	pk, ck, ok := c.keyHash(key)
 	if !ok {
 		return false
@@ -152,6 +160,8 @@ func (c *LRU) PushBack(key, value interface{}) bool {
 
 // Get looks up a key's value from the cache.
 func (c *LRU) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	pk, ck, ok := c.keyHash(key)
 	if !ok {
 		return nil, false
@@ -168,6 +178,8 @@ func (c *LRU) Get(key interface{}) (interface{}, bool) {
 
 // Contains checks if a key is in the cache.
 func (c *LRU) Contains(key interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	pk, ck, ok := c.keyHash(key)
 	if !ok {
 		return false
@@ -185,6 +197,8 @@ func (c *LRU) Contains(key interface{}) bool {
 // Peek returns the key value (or undefined if not found) without updating
 // the "recently used"-ness of the key.
 func (c *LRU) Peek(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	pk, ck, ok := c.keyHash(key)
 	if !ok {
 		return nil, false
@@ -199,6 +213,8 @@ func (c *LRU) Peek(key interface{}) (interface{}, bool) {
 // Remove removes the provided key from the cache, returning if the
 // key was contained.
 func (c *LRU) Remove(key interface{}) (present bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	pk, ck, ok := c.keyHash(key)
 	if !ok {
 		return false
@@ -212,6 +228,8 @@ func (c *LRU) Remove(key interface{}) (present bool) {
 
 // RemoveOldest removes the oldest item from the cache.
 func (c *LRU) RemoveOldest() (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	ent := c.evictList.Back()
 	if ent != nil {
 		c.removeElement(ent)
@@ -223,10 +241,14 @@ func (c *LRU) RemoveOldest() (interface{}, bool) {
 
 // Len returns the number of items in the cache.
 func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.evictList.Len()
 }
 
 func (c *LRU) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.currentSize
 }
 
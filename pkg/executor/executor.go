@@ -1 +1,275 @@
 package executor
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	gstatus "google.golang.org/grpc/status"
+
+	"github.com/dashjay/baize/pkg/admission"
+	"github.com/dashjay/baize/pkg/config"
+	schedulerpb "github.com/dashjay/baize/pkg/proto/scheduler"
+	"github.com/dashjay/baize/pkg/utils/platform"
+)
+
+const (
+	defaultHeartBeatInterval = 10 * time.Second
+
+	// retryInterval is how long to wait before retrying when the scheduler is unreachable
+	retryInterval = time.Second
+)
+
+// JobRunner runs a job pulled from the scheduler, it returns the ActionResult
+// and the digest of the ActionResult uploaded to CAS. The ActionResult may
+// also be returned along with an error if partial outputs are available.
+// Outputs of the command are also written to stdout and stderr if they are not nil.
+type JobRunner interface {
+	RunJob(ctx context.Context, job *schedulerpb.GetJobResp, stdout, stderr io.Writer) (*repb.ActionResult, *repb.Digest, error)
+}
+
+// Executor works in worker mode, it reports itself to the scheduler by HeartBeat
+// and pulls jobs by GetJob, then runs them with JobRunner. Jobs are run at the same time
+// while CPU slots and memory they request are available.
+type Executor struct {
+	id                string
+	schedulerAddr     string
+	heartBeatInterval time.Duration
+	property          *schedulerpb.Property
+	runner            JobRunner
+	admission         *admission.Controller
+
+	mu sync.Mutex
+	// running holds cancel functions of running jobs by job id
+	running map[string]context.CancelFunc
+}
+
+func New(cfg *config.ExecutorConfig, runner JobRunner) *Executor {
+	ac := admission.NewFromConfig(cfg)
+	e := &Executor{
+		id:                cfg.GetExecutorID(),
+		schedulerAddr:     cfg.SchedulerAddr,
+		heartBeatInterval: defaultHeartBeatInterval,
+		property:          hostProperty(cfg, ac.Capacity()),
+		runner:            runner,
+		admission:         ac,
+		running:           make(map[string]context.CancelFunc),
+	}
+	if e.id == "" {
+		e.id = uuid.New().String()
+	}
+	if cfg.HeartBeatInterval > 0 {
+		e.heartBeatInterval = time.Duration(cfg.HeartBeatInterval) * time.Second
+	}
+	return e
+}
+
+// hostProperty reports CPU slots and memory shared by jobs and platform of the executor
+func hostProperty(cfg *config.ExecutorConfig, capacity admission.Request) *schedulerpb.Property {
+	return &schedulerpb.Property{Cpu: int32(capacity.CPUs), Memory: capacity.MemoryBytes, Platform: platform.New(cfg)}
+}
+
+// Run connects to the scheduler and pulls jobs until ctx is done
+func (e *Executor) Run(ctx context.Context) error {
+	conn, err := grpc.DialContext(ctx, e.schedulerAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := schedulerpb.NewSchedulerClient(conn)
+	logrus.Infof("executor %s works for scheduler %s with %s", e.id, e.schedulerAddr, e.property)
+
+	e.heartBeat(ctx, client)
+	go func() {
+		t := time.NewTicker(e.heartBeatInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				e.heartBeat(ctx, client)
+			}
+		}
+	}()
+
+	for ctx.Err() == nil {
+		// jobs are only pulled when one could start at once, others are left to executors with free resources
+		if err := e.admission.WaitAvailable(ctx); err != nil {
+			break
+		}
+		job, err := client.GetJob(ctx, &schedulerpb.GetJobReq{ExecutorId: e.id})
+		if err != nil {
+			logrus.WithError(err).Warn("get job from scheduler error")
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryInterval):
+			}
+			// re-register in case the scheduler restarted or expired us
+			e.heartBeat(ctx, client)
+			continue
+		}
+		if job.GetJob() == nil {
+			continue
+		}
+		release, err := e.acquire(ctx, job)
+		if err != nil {
+			logrus.WithError(err).Errorf("admit job %s error", job.GetJobId())
+			e.failJob(ctx, client, job, err, nil)
+			continue
+		}
+		go func() {
+			defer release()
+			e.runJob(ctx, client, job)
+		}()
+	}
+	return ctx.Err()
+}
+
+// acquire takes CPU slots and memory requested by the platform of job
+func (e *Executor) acquire(ctx context.Context, job *schedulerpb.GetJobResp) (func(), error) {
+	r, err := e.admission.Request(job.GetPlatform())
+	if err != nil {
+		return nil, err
+	}
+	return e.admission.Acquire(ctx, r)
+}
+
+func (e *Executor) heartBeat(ctx context.Context, client schedulerpb.SchedulerClient) {
+	resp, err := client.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorInfo: e.property, ExecutorId: e.id})
+	if err != nil {
+		logrus.WithError(err).Warn("heartbeat to scheduler error")
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range resp.GetCanceledJobIds() {
+		if cancel, exists := e.running[id]; exists {
+			logrus.Infof("job %s canceled by scheduler", id)
+			cancel()
+		}
+	}
+}
+
+// runJob runs the job and reports the outcome by FinishJob or FailJob
+func (e *Executor) runJob(ctx context.Context, client schedulerpb.SchedulerClient, job *schedulerpb.GetJobResp) {
+	logrus.Infof("run job %s of action %s", job.GetJobId(), job.GetActionDigest().GetHash())
+	jobCtx, cancel := context.WithCancel(ctx)
+	e.mu.Lock()
+	e.running[job.GetJobId()] = cancel
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.running, job.GetJobId())
+		e.mu.Unlock()
+		cancel()
+	}()
+
+	log := e.openJobLog(jobCtx, client, job)
+	result, resultDigest, err := e.runner.RunJob(jobCtx, job, log.writer(false), log.writer(true))
+	// outputs are forwarded before the job completes, the server finishes its log streams then
+	log.close()
+	if jobCtx.Err() != nil && ctx.Err() == nil {
+		// the scheduler has already completed a canceled job
+		logrus.Infof("job %s stopped for canceled", job.GetJobId())
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Errorf("run job %s error", job.GetJobId())
+		e.failJob(ctx, client, job, err, resultDigest)
+		return
+	}
+	logrus.Infof("job %s finished with exit code %d", job.GetJobId(), result.GetExitCode())
+	_, err = client.FinishJob(ctx, &schedulerpb.FinishJobReq{
+		ExecutorId:         e.id,
+		JobId:              job.GetJobId(),
+		ActionResultDigest: resultDigest,
+		ExecutionMetadata:  result.GetExecutionMetadata(),
+	})
+	if err != nil {
+		logrus.WithError(err).Errorf("report finish of job %s error", job.GetJobId())
+	}
+}
+
+func (e *Executor) failJob(ctx context.Context, client schedulerpb.SchedulerClient, job *schedulerpb.GetJobResp, err error, resultDigest *repb.Digest) {
+	_, err = client.FailJob(ctx, &schedulerpb.FailJobReq{
+		ExecutorId:         e.id,
+		JobId:              job.GetJobId(),
+		Status:             gstatus.Convert(err).Proto(),
+		ActionResultDigest: resultDigest,
+	})
+	if err != nil {
+		logrus.WithError(err).Errorf("report failure of job %s error", job.GetJobId())
+	}
+}
+
+// jobLog forwards outputs of the command of a job to the scheduler by WriteJobLog.
+// Outputs are dropped once forwarding failed, the command must not fail for it.
+type jobLog struct {
+	mu         sync.Mutex
+	stream     schedulerpb.Scheduler_WriteJobLogClient
+	executorID string
+	jobID      string
+}
+
+// openJobLog returns a jobLog of job, outputs are not forwarded if the scheduler can not be reached
+func (e *Executor) openJobLog(ctx context.Context, client schedulerpb.SchedulerClient, job *schedulerpb.GetJobResp) *jobLog {
+	log := &jobLog{executorID: e.id, jobID: job.GetJobId()}
+	stream, err := client.WriteJobLog(ctx)
+	if err != nil {
+		logrus.WithError(err).Warnf("forward log of job %s error", job.GetJobId())
+		return log
+	}
+	log.stream = stream
+	return log
+}
+
+// writer returns the writer of stdout, or stderr if stderr is set, nil if outputs are not forwarded
+func (l *jobLog) writer(stderr bool) io.Writer {
+	if l.stream == nil {
+		return nil
+	}
+	return &jobLogWriter{log: l, stderr: stderr}
+}
+
+func (l *jobLog) send(stderr bool, data []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stream == nil {
+		return
+	}
+	err := l.stream.Send(&schedulerpb.WriteJobLogReq{ExecutorId: l.executorID, JobId: l.jobID, Stderr: stderr, Data: data})
+	if err != nil {
+		logrus.WithError(err).Warnf("forward log of job %s error", l.jobID)
+		l.stream = nil
+	}
+}
+
+func (l *jobLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stream == nil {
+		return
+	}
+	if _, err := l.stream.CloseAndRecv(); err != nil {
+		logrus.WithError(err).Warnf("forward log of job %s error", l.jobID)
+	}
+	l.stream = nil
+}
+
+type jobLogWriter struct {
+	log    *jobLog
+	stderr bool
+}
+
+func (w *jobLogWriter) Write(p []byte) (int, error) {
+	w.log.send(w.stderr, p)
+	return len(p), nil
+}
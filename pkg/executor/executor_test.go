@@ -0,0 +1,154 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/dashjay/baize/pkg/config"
+	schedulerpb "github.com/dashjay/baize/pkg/proto/scheduler"
+	"github.com/dashjay/baize/pkg/scheduler"
+	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// fakeRunner runs jobs by fn and counts runs of every job
+type fakeRunner struct {
+	mu   sync.Mutex
+	runs map[string]int
+	fn   func(ctx context.Context, run int, stdout io.Writer) (*repb.ActionResult, *repb.Digest, error)
+}
+
+func (f *fakeRunner) RunJob(ctx context.Context, job *schedulerpb.GetJobResp, stdout, stderr io.Writer) (*repb.ActionResult, *repb.Digest, error) {
+	f.mu.Lock()
+	f.runs[job.GetJobId()]++
+	run := f.runs[job.GetJobId()]
+	f.mu.Unlock()
+	return f.fn(ctx, run, stdout)
+}
+
+func (f *fakeRunner) runsOf(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.runs[id]
+}
+
+var _ = Describe("test executor", func() {
+	var (
+		ctx      context.Context
+		cancel   context.CancelFunc
+		s        *scheduler.Scheduler
+		server   *grpc.Server
+		runner   *fakeRunner
+		executed = utils.CalSHA256OfInput([]byte("action result"))
+	)
+	// enqueue schedules a job and waits for the executor to report its result
+	enqueue := func(id string) (*scheduler.JobResult, string) {
+		var mu sync.Mutex
+		var stdout string
+		job := &scheduler.Job{
+			ID:           id,
+			ActionDigest: utils.CalSHA256OfInput([]byte(id)),
+			Action:       &repb.Action{},
+			OnLog: func(stderr bool, data []byte) {
+				mu.Lock()
+				defer mu.Unlock()
+				stdout += string(data)
+			},
+		}
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		mu.Lock()
+		defer mu.Unlock()
+		return result, stdout
+	}
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+		s = scheduler.NewScheduler(&config.ServerConfig{})
+		server = grpc.NewServer()
+		schedulerpb.RegisterSchedulerServer(server, s)
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		go server.Serve(lis)
+
+		runner = &fakeRunner{runs: make(map[string]int)}
+		e := New(&config.ExecutorConfig{SchedulerAddr: lis.Addr().String(), ExecutorID: "executor"}, runner)
+		e.heartBeatInterval = 50 * time.Millisecond
+		go e.Run(ctx)
+	})
+	AfterEach(func() {
+		cancel()
+		server.Stop()
+		s.Stop()
+	})
+	It("stop at once while waiting to retry", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		Expect(lis.Close()).To(BeNil())
+		e := New(&config.ExecutorConfig{SchedulerAddr: lis.Addr().String(), ExecutorID: "unreachable"}, runner)
+		runCtx, stop := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- e.Run(runCtx)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		stop()
+		Eventually(done, retryInterval/2).Should(Receive(Equal(context.Canceled)))
+	})
+	It("finish jobs run successfully", func() {
+		runner.fn = func(ctx context.Context, run int, stdout io.Writer) (*repb.ActionResult, *repb.Digest, error) {
+			stdout.Write([]byte("hello"))
+			return &repb.ActionResult{ExecutionMetadata: &repb.ExecutedActionMetadata{Worker: "executor"}}, executed, nil
+		}
+		result, stdout := enqueue("job-1")
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.OK)))
+		Expect(result.ActionResultDigest.GetHash()).To(Equal(executed.GetHash()))
+		Expect(result.ExecutionMetadata.GetWorker()).To(Equal("executor"))
+		Expect(stdout).To(Equal("hello"))
+	})
+	It("fail jobs failed by actions", func() {
+		runner.fn = func(ctx context.Context, run int, stdout io.Writer) (*repb.ActionResult, *repb.Digest, error) {
+			return &repb.ActionResult{}, executed, status.DeadlineExceededError("action timed out")
+		}
+		result, _ := enqueue("job-1")
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.DeadlineExceeded)))
+		Expect(result.ActionResultDigest.GetHash()).To(Equal(executed.GetHash()))
+		Expect(runner.runsOf("job-1")).To(Equal(1))
+	})
+	It("run jobs failed by the executor again", func() {
+		runner.fn = func(ctx context.Context, run int, stdout io.Writer) (*repb.ActionResult, *repb.Digest, error) {
+			if run == 1 {
+				return nil, nil, status.UnavailableError("docker daemon is not running")
+			}
+			return &repb.ActionResult{}, executed, nil
+		}
+		result, _ := enqueue("job-1")
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.OK)))
+		Expect(runner.runsOf("job-1")).To(Equal(2))
+	})
+	It("stop jobs canceled on heartbeat", func() {
+		stopped := make(chan struct{})
+		runner.fn = func(ctx context.Context, run int, stdout io.Writer) (*repb.ActionResult, *repb.Digest, error) {
+			<-ctx.Done()
+			close(stopped)
+			return nil, nil, status.CanceledError("canceled")
+		}
+		job := &scheduler.Job{ID: "job-1", ActionDigest: executed, Action: &repb.Action{}}
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		Eventually(func() int { return runner.runsOf("job-1") }).Should(Equal(1))
+		s.CancelJob("job-1")
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.Canceled)))
+		Eventually(stopped).Should(BeClosed())
+	})
+})
@@ -0,0 +1,16 @@
+package executor
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestExecutor(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "executor suite test")
+}
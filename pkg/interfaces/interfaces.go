@@ -5,6 +5,8 @@ import (
 	"io"
 
 	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+
+	usagepb "github.com/dashjay/baize/pkg/proto/usage"
 )
 
 type LRU interface {
@@ -47,11 +49,27 @@ type Cache interface {
 	SetMulti(ctx context.Context, kvs map[*repb.Digest][]byte) error
 	Delete(ctx context.Context, d *repb.Digest) error
 	Reader(ctx context.Context, d *repb.Digest, offset int64) (io.ReadCloser, error)
-	Writer(ctx context.Context, d *repb.Digest) (io.WriteCloser, error)
+	Writer(ctx context.Context, d *repb.Digest) (BlobWriter, error)
 	Size() int64
+	// MaxBlobSize returns the max size in bytes of a single blob the cache accepts
+	MaxBlobSize() int64
 	Check(ctx context.Context) error
 }
 
+// BlobWriter stores the blob written into it on Close, Abort drops what has been written instead,
+// the blob already stored under the same digest is left untouched.
+type BlobWriter interface {
+	io.WriteCloser
+	Abort() error
+}
+
+// LocalFileCache is implemented by caches keeping blobs as files on local disk,
+// executors link the files into exec roots instead of copying them.
+type LocalFileCache interface {
+	// Acquire returns path of the blob and pins it from being removed until release is called
+	Acquire(ctx context.Context, d *repb.Digest) (path string, release func(), err error)
+}
+
 type CacheType int
 
 const (
@@ -71,6 +89,13 @@ func (t CacheType) Prefix() string {
 	}
 }
 
+// CommandRunner runs commands of actions, e.g. on the host or in containers
+type CommandRunner interface {
+	// Run runs command in workDir which is under execRoot, the input root of the action.
+	// Outputs of the command are also written to stdout and stderr if they are not nil.
+	Run(ctx context.Context, command *repb.Command, execRoot, workDir string, stdout, stderr io.Writer) *CommandResult
+}
+
 // CommandResult captures the output and details of an executed command.
 // Copy from buildbuddy server/interfaces/interfaces.go:456
 type CommandResult struct {
@@ -106,4 +131,6 @@ type CommandResult struct {
 	// * -2 (NoExitCode) if the exit code could not be determined because it returned
 	//   an error other than exec.ExitError. This case typically means it failed to start.
 	ExitCode int
+	// UsageStats is resources used by the command, nil if they are unknown
+	UsageStats *usagepb.UsageStats
 }
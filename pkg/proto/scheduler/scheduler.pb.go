@@ -33,6 +33,8 @@ type Property struct {
 
 	Cpu    int32 `protobuf:"varint,1,opt,name=Cpu,proto3" json:"Cpu,omitempty"`
 	Memory int64 `protobuf:"varint,2,opt,name=Memory,proto3" json:"Memory,omitempty"`
+	// platform properties declared by the executor, jobs are only assigned to executors satisfying their platform
+	Platform *v2.Platform `protobuf:"bytes,3,opt,name=platform,proto3" json:"platform,omitempty"`
 }
 
 func (x *Property) Reset() {
@@ -81,6 +83,13 @@ func (x *Property) GetMemory() int64 {
 	return 0
 }
 
+func (x *Property) GetPlatform() *v2.Platform {
+	if x != nil {
+		return x.Platform
+	}
+	return nil
+}
+
 type HeartBeatReq struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -114,29 +123,539 @@ func (x *HeartBeatReq) ProtoReflect() protoreflect.Message {
 		}
 		return ms
 	}
-	return mi.MessageOf(x)
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartBeatReq.ProtoReflect.Descriptor instead.
+func (*HeartBeatReq) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *HeartBeatReq) GetExecutorInfo() *Property {
+	if x != nil {
+		return x.ExecutorInfo
+	}
+	return nil
+}
+
+func (x *HeartBeatReq) GetExecutorId() string {
+	if x != nil {
+		return x.ExecutorId
+	}
+	return ""
+}
+
+type HeartBeatResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Status *status.Status `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	// jobs running on the executor which have been canceled
+	CanceledJobIds []string `protobuf:"bytes,2,rep,name=canceled_job_ids,json=canceledJobIds,proto3" json:"canceled_job_ids,omitempty"`
+}
+
+func (x *HeartBeatResp) Reset() {
+	*x = HeartBeatResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *HeartBeatResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartBeatResp) ProtoMessage() {}
+
+func (x *HeartBeatResp) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartBeatResp.ProtoReflect.Descriptor instead.
+func (*HeartBeatResp) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *HeartBeatResp) GetStatus() *status.Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *HeartBeatResp) GetCanceledJobIds() []string {
+	if x != nil {
+		return x.CanceledJobIds
+	}
+	return nil
+}
+
+type GetJobReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ExecutorId string `protobuf:"bytes,1,opt,name=executor_id,json=executorId,proto3" json:"executor_id,omitempty"`
+}
+
+func (x *GetJobReq) Reset() {
+	*x = GetJobReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetJobReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobReq) ProtoMessage() {}
+
+func (x *GetJobReq) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobReq.ProtoReflect.Descriptor instead.
+func (*GetJobReq) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetJobReq) GetExecutorId() string {
+	if x != nil {
+		return x.ExecutorId
+	}
+	return ""
+}
+
+type GetJobResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Job          *v2.Action `protobuf:"bytes,1,opt,name=job,proto3" json:"job,omitempty"`
+	JobId        string     `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	ActionDigest *v2.Digest `protobuf:"bytes,3,opt,name=action_digest,json=actionDigest,proto3" json:"action_digest,omitempty"`
+	InstanceName string     `protobuf:"bytes,4,opt,name=instance_name,json=instanceName,proto3" json:"instance_name,omitempty"`
+	// platform of the action, resources it requests are taken before running it
+	Platform *v2.Platform `protobuf:"bytes,5,opt,name=platform,proto3" json:"platform,omitempty"`
+}
+
+func (x *GetJobResp) Reset() {
+	*x = GetJobResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetJobResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobResp) ProtoMessage() {}
+
+func (x *GetJobResp) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobResp.ProtoReflect.Descriptor instead.
+func (*GetJobResp) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetJobResp) GetJob() *v2.Action {
+	if x != nil {
+		return x.Job
+	}
+	return nil
+}
+
+func (x *GetJobResp) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *GetJobResp) GetActionDigest() *v2.Digest {
+	if x != nil {
+		return x.ActionDigest
+	}
+	return nil
+}
+
+func (x *GetJobResp) GetInstanceName() string {
+	if x != nil {
+		return x.InstanceName
+	}
+	return ""
+}
+
+func (x *GetJobResp) GetPlatform() *v2.Platform {
+	if x != nil {
+		return x.Platform
+	}
+	return nil
+}
+
+type FinishJobReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ExecutorId string `protobuf:"bytes,1,opt,name=executor_id,json=executorId,proto3" json:"executor_id,omitempty"`
+	JobId      string `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	// digest of the ActionResult uploaded to CAS
+	ActionResultDigest *v2.Digest                 `protobuf:"bytes,3,opt,name=action_result_digest,json=actionResultDigest,proto3" json:"action_result_digest,omitempty"`
+	ExecutionMetadata  *v2.ExecutedActionMetadata `protobuf:"bytes,4,opt,name=execution_metadata,json=executionMetadata,proto3" json:"execution_metadata,omitempty"`
+}
+
+func (x *FinishJobReq) Reset() {
+	*x = FinishJobReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FinishJobReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FinishJobReq) ProtoMessage() {}
+
+func (x *FinishJobReq) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FinishJobReq.ProtoReflect.Descriptor instead.
+func (*FinishJobReq) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *FinishJobReq) GetExecutorId() string {
+	if x != nil {
+		return x.ExecutorId
+	}
+	return ""
+}
+
+func (x *FinishJobReq) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *FinishJobReq) GetActionResultDigest() *v2.Digest {
+	if x != nil {
+		return x.ActionResultDigest
+	}
+	return nil
+}
+
+func (x *FinishJobReq) GetExecutionMetadata() *v2.ExecutedActionMetadata {
+	if x != nil {
+		return x.ExecutionMetadata
+	}
+	return nil
+}
+
+type FinishJobResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Status *status.Status `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+}
+
+func (x *FinishJobResp) Reset() {
+	*x = FinishJobResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FinishJobResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FinishJobResp) ProtoMessage() {}
+
+func (x *FinishJobResp) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FinishJobResp.ProtoReflect.Descriptor instead.
+func (*FinishJobResp) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FinishJobResp) GetStatus() *status.Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+type FailJobReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ExecutorId string         `protobuf:"bytes,1,opt,name=executor_id,json=executorId,proto3" json:"executor_id,omitempty"`
+	JobId      string         `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Status     *status.Status `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	// action_result_digest is set if partial outputs of the job were uploaded, e.g. timed out
+	ActionResultDigest *v2.Digest `protobuf:"bytes,4,opt,name=action_result_digest,json=actionResultDigest,proto3" json:"action_result_digest,omitempty"`
+}
+
+func (x *FailJobReq) Reset() {
+	*x = FailJobReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FailJobReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailJobReq) ProtoMessage() {}
+
+func (x *FailJobReq) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailJobReq.ProtoReflect.Descriptor instead.
+func (*FailJobReq) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *FailJobReq) GetExecutorId() string {
+	if x != nil {
+		return x.ExecutorId
+	}
+	return ""
+}
+
+func (x *FailJobReq) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *FailJobReq) GetStatus() *status.Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *FailJobReq) GetActionResultDigest() *v2.Digest {
+	if x != nil {
+		return x.ActionResultDigest
+	}
+	return nil
+}
+
+type FailJobResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Status *status.Status `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+}
+
+func (x *FailJobResp) Reset() {
+	*x = FailJobResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FailJobResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailJobResp) ProtoMessage() {}
+
+func (x *FailJobResp) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailJobResp.ProtoReflect.Descriptor instead.
+func (*FailJobResp) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *FailJobResp) GetStatus() *status.Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+type ScheduleJobReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	JobId        string     `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	InstanceName string     `protobuf:"bytes,2,opt,name=instance_name,json=instanceName,proto3" json:"instance_name,omitempty"`
+	ActionDigest *v2.Digest `protobuf:"bytes,3,opt,name=action_digest,json=actionDigest,proto3" json:"action_digest,omitempty"`
+	Action       *v2.Action `protobuf:"bytes,4,opt,name=action,proto3" json:"action,omitempty"`
+	// lower value means higher priority, the same as ExecutionPolicy.priority
+	Priority int32 `protobuf:"varint,5,opt,name=priority,proto3" json:"priority,omitempty"`
+	// platform required by the action, from Action.platform or Command.platform
+	Platform *v2.Platform `protobuf:"bytes,6,opt,name=platform,proto3" json:"platform,omitempty"`
+}
+
+func (x *ScheduleJobReq) Reset() {
+	*x = ScheduleJobReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ScheduleJobReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScheduleJobReq) ProtoMessage() {}
+
+func (x *ScheduleJobReq) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScheduleJobReq.ProtoReflect.Descriptor instead.
+func (*ScheduleJobReq) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ScheduleJobReq) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
 }
 
-// Deprecated: Use HeartBeatReq.ProtoReflect.Descriptor instead.
-func (*HeartBeatReq) Descriptor() ([]byte, []int) {
-	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{1}
+func (x *ScheduleJobReq) GetInstanceName() string {
+	if x != nil {
+		return x.InstanceName
+	}
+	return ""
 }
 
-func (x *HeartBeatReq) GetExecutorInfo() *Property {
+func (x *ScheduleJobReq) GetActionDigest() *v2.Digest {
 	if x != nil {
-		return x.ExecutorInfo
+		return x.ActionDigest
 	}
 	return nil
 }
 
-func (x *HeartBeatReq) GetExecutorId() string {
+func (x *ScheduleJobReq) GetAction() *v2.Action {
 	if x != nil {
-		return x.ExecutorId
+		return x.Action
 	}
-	return ""
+	return nil
 }
 
-type HeartBeatResp struct {
+func (x *ScheduleJobReq) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *ScheduleJobReq) GetPlatform() *v2.Platform {
+	if x != nil {
+		return x.Platform
+	}
+	return nil
+}
+
+type ScheduleJobResp struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
@@ -144,23 +663,23 @@ type HeartBeatResp struct {
 	Status *status.Status `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
 }
 
-func (x *HeartBeatResp) Reset() {
-	*x = HeartBeatResp{}
+func (x *ScheduleJobResp) Reset() {
+	*x = ScheduleJobResp{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[2]
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[10]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *HeartBeatResp) String() string {
+func (x *ScheduleJobResp) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*HeartBeatResp) ProtoMessage() {}
+func (*ScheduleJobResp) ProtoMessage() {}
 
-func (x *HeartBeatResp) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[2]
+func (x *ScheduleJobResp) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[10]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -171,43 +690,47 @@ func (x *HeartBeatResp) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use HeartBeatResp.ProtoReflect.Descriptor instead.
-func (*HeartBeatResp) Descriptor() ([]byte, []int) {
-	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{2}
+// Deprecated: Use ScheduleJobResp.ProtoReflect.Descriptor instead.
+func (*ScheduleJobResp) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{10}
 }
 
-func (x *HeartBeatResp) GetStatus() *status.Status {
+func (x *ScheduleJobResp) GetStatus() *status.Status {
 	if x != nil {
 		return x.Status
 	}
 	return nil
 }
 
-type GetJobReq struct {
+type WriteJobLogReq struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	ExecutorId string `protobuf:"bytes,1,opt,name=executor_id,json=executorId,proto3" json:"executor_id,omitempty"`
+	JobId      string `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	// data is written to stderr of the job if set, stdout otherwise
+	Stderr bool   `protobuf:"varint,3,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	Data   []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
 }
 
-func (x *GetJobReq) Reset() {
-	*x = GetJobReq{}
+func (x *WriteJobLogReq) Reset() {
+	*x = WriteJobLogReq{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[3]
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[11]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *GetJobReq) String() string {
+func (x *WriteJobLogReq) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetJobReq) ProtoMessage() {}
+func (*WriteJobLogReq) ProtoMessage() {}
 
-func (x *GetJobReq) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[3]
+func (x *WriteJobLogReq) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[11]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -218,43 +741,64 @@ func (x *GetJobReq) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetJobReq.ProtoReflect.Descriptor instead.
-func (*GetJobReq) Descriptor() ([]byte, []int) {
-	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use WriteJobLogReq.ProtoReflect.Descriptor instead.
+func (*WriteJobLogReq) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *GetJobReq) GetExecutorId() string {
+func (x *WriteJobLogReq) GetExecutorId() string {
 	if x != nil {
 		return x.ExecutorId
 	}
 	return ""
 }
 
-type GetJobResp struct {
+func (x *WriteJobLogReq) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *WriteJobLogReq) GetStderr() bool {
+	if x != nil {
+		return x.Stderr
+	}
+	return false
+}
+
+func (x *WriteJobLogReq) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type WriteJobLogResp struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Job *v2.Action `protobuf:"bytes,1,opt,name=job,proto3" json:"job,omitempty"`
+	Status *status.Status `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
 }
 
-func (x *GetJobResp) Reset() {
-	*x = GetJobResp{}
+func (x *WriteJobLogResp) Reset() {
+	*x = WriteJobLogResp{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[4]
+		mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[12]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *GetJobResp) String() string {
+func (x *WriteJobLogResp) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetJobResp) ProtoMessage() {}
+func (*WriteJobLogResp) ProtoMessage() {}
 
-func (x *GetJobResp) ProtoReflect() protoreflect.Message {
-	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[4]
+func (x *WriteJobLogResp) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_scheduler_scheduler_proto_msgTypes[12]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -265,14 +809,14 @@ func (x *GetJobResp) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetJobResp.ProtoReflect.Descriptor instead.
-func (*GetJobResp) Descriptor() ([]byte, []int) {
-	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use WriteJobLogResp.ProtoReflect.Descriptor instead.
+func (*WriteJobLogResp) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP(), []int{12}
 }
 
-func (x *GetJobResp) GetJob() *v2.Action {
+func (x *WriteJobLogResp) GetStatus() *status.Status {
 	if x != nil {
-		return x.Job
+		return x.Status
 	}
 	return nil
 }
@@ -288,41 +832,150 @@ var file_pkg_proto_scheduler_scheduler_proto_rawDesc = []byte{
 	0x2f, 0x62, 0x61, 0x7a, 0x65, 0x6c, 0x2f, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2f, 0x65, 0x78,
 	0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2f, 0x76, 0x32, 0x2f, 0x72, 0x65, 0x6d, 0x6f, 0x74,
 	0x65, 0x5f, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x22, 0x34, 0x0a, 0x08, 0x50, 0x72, 0x6f, 0x70, 0x65, 0x72, 0x74, 0x79, 0x12, 0x10, 0x0a,
+	0x6f, 0x22, 0x7b, 0x0a, 0x08, 0x50, 0x72, 0x6f, 0x70, 0x65, 0x72, 0x74, 0x79, 0x12, 0x10, 0x0a,
 	0x03, 0x43, 0x70, 0x75, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x03, 0x43, 0x70, 0x75, 0x12,
 	0x16, 0x0a, 0x06, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
-	0x06, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x22, 0x69, 0x0a, 0x0c, 0x48, 0x65, 0x61, 0x72, 0x74,
-	0x42, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x12, 0x38, 0x0a, 0x0d, 0x65, 0x78, 0x65, 0x63, 0x75,
-	0x74, 0x6f, 0x72, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13,
-	0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x50, 0x72, 0x6f, 0x70, 0x65,
-	0x72, 0x74, 0x79, 0x52, 0x0c, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x49, 0x6e, 0x66,
-	0x6f, 0x12, 0x1f, 0x0a, 0x0b, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x5f, 0x69, 0x64,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72,
-	0x49, 0x64, 0x22, 0x3b, 0x0a, 0x0d, 0x48, 0x65, 0x61, 0x72, 0x74, 0x42, 0x65, 0x61, 0x74, 0x52,
-	0x65, 0x73, 0x70, 0x12, 0x2a, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x72, 0x70, 0x63,
-	0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22,
-	0x2c, 0x0a, 0x09, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x12, 0x1f, 0x0a, 0x0b,
-	0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x49, 0x64, 0x22, 0x47, 0x0a,
-	0x0a, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x12, 0x39, 0x0a, 0x03, 0x6a,
-	0x6f, 0x62, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64,
+	0x06, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x12, 0x45, 0x0a, 0x08, 0x70, 0x6c, 0x61, 0x74, 0x66,
+	0x6f, 0x72, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x29, 0x2e, 0x62, 0x75, 0x69, 0x6c,
+	0x64, 0x2e, 0x62, 0x61, 0x7a, 0x65, 0x6c, 0x2e, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65,
+	0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x32, 0x2e, 0x50, 0x6c, 0x61, 0x74,
+	0x66, 0x6f, 0x72, 0x6d, 0x52, 0x08, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x22, 0x69,
+	0x0a, 0x0c, 0x48, 0x65, 0x61, 0x72, 0x74, 0x42, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x12, 0x38,
+	0x0a, 0x0d, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65,
+	0x72, 0x2e, 0x50, 0x72, 0x6f, 0x70, 0x65, 0x72, 0x74, 0x79, 0x52, 0x0c, 0x65, 0x78, 0x65, 0x63,
+	0x75, 0x74, 0x6f, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1f, 0x0a, 0x0b, 0x65, 0x78, 0x65, 0x63,
+	0x75, 0x74, 0x6f, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x65,
+	0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x49, 0x64, 0x22, 0x65, 0x0a, 0x0d, 0x48, 0x65, 0x61,
+	0x72, 0x74, 0x42, 0x65, 0x61, 0x74, 0x52, 0x65, 0x73, 0x70, 0x12, 0x2a, 0x0a, 0x06, 0x73, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x06,
+	0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x28, 0x0a, 0x10, 0x63, 0x61, 0x6e, 0x63, 0x65, 0x6c,
+	0x65, 0x64, 0x5f, 0x6a, 0x6f, 0x62, 0x5f, 0x69, 0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09,
+	0x52, 0x0e, 0x63, 0x61, 0x6e, 0x63, 0x65, 0x6c, 0x65, 0x64, 0x4a, 0x6f, 0x62, 0x49, 0x64, 0x73,
+	0x22, 0x2c, 0x0a, 0x09, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x12, 0x1f, 0x0a,
+	0x0b, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x49, 0x64, 0x22, 0x98,
+	0x02, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x12, 0x39, 0x0a,
+	0x03, 0x6a, 0x6f, 0x62, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x62, 0x75, 0x69,
+	0x6c, 0x64, 0x2e, 0x62, 0x61, 0x7a, 0x65, 0x6c, 0x2e, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e,
+	0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x32, 0x2e, 0x41, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x03, 0x6a, 0x6f, 0x62, 0x12, 0x15, 0x0a, 0x06, 0x6a, 0x6f, 0x62, 0x5f,
+	0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6a, 0x6f, 0x62, 0x49, 0x64, 0x12,
+	0x4c, 0x0a, 0x0d, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2e, 0x62,
+	0x61, 0x7a, 0x65, 0x6c, 0x2e, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65, 0x78, 0x65, 0x63,
+	0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x32, 0x2e, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x52,
+	0x0c, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x12, 0x23, 0x0a,
+	0x0d, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x4e, 0x61,
+	0x6d, 0x65, 0x12, 0x45, 0x0a, 0x08, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x29, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2e, 0x62, 0x61, 0x7a,
+	0x65, 0x6c, 0x2e, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74,
+	0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x32, 0x2e, 0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x52,
+	0x08, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x22, 0x89, 0x02, 0x0a, 0x0c, 0x46, 0x69,
+	0x6e, 0x69, 0x73, 0x68, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x12, 0x1f, 0x0a, 0x0b, 0x65, 0x78,
+	0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0a, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x49, 0x64, 0x12, 0x15, 0x0a, 0x06, 0x6a,
+	0x6f, 0x62, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6a, 0x6f, 0x62,
+	0x49, 0x64, 0x12, 0x59, 0x0a, 0x14, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x72, 0x65, 0x73,
+	0x75, 0x6c, 0x74, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x27, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2e, 0x62, 0x61, 0x7a, 0x65, 0x6c, 0x2e, 0x72,
+	0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2e,
+	0x76, 0x32, 0x2e, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x52, 0x12, 0x61, 0x63, 0x74, 0x69, 0x6f,
+	0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x12, 0x66, 0x0a,
+	0x12, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6d, 0x65, 0x74, 0x61, 0x64,
+	0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x37, 0x2e, 0x62, 0x75, 0x69, 0x6c,
+	0x64, 0x2e, 0x62, 0x61, 0x7a, 0x65, 0x6c, 0x2e, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65,
+	0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x32, 0x2e, 0x45, 0x78, 0x65, 0x63,
+	0x75, 0x74, 0x65, 0x64, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61,
+	0x74, 0x61, 0x52, 0x11, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x65, 0x74,
+	0x61, 0x64, 0x61, 0x74, 0x61, 0x22, 0x3b, 0x0a, 0x0d, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x4a,
+	0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x12, 0x2a, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x72, 0x70, 0x63, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x22, 0xcb, 0x01, 0x0a, 0x0a, 0x46, 0x61, 0x69, 0x6c, 0x4a, 0x6f, 0x62, 0x52, 0x65,
+	0x71, 0x12, 0x1f, 0x0a, 0x0b, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x5f, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72,
+	0x49, 0x64, 0x12, 0x15, 0x0a, 0x06, 0x6a, 0x6f, 0x62, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x6a, 0x6f, 0x62, 0x49, 0x64, 0x12, 0x2a, 0x0a, 0x06, 0x73, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x06, 0x73,
+	0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x59, 0x0a, 0x14, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f,
+	0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2e, 0x62, 0x61, 0x7a, 0x65,
+	0x6c, 0x2e, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69,
+	0x6f, 0x6e, 0x2e, 0x76, 0x32, 0x2e, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x52, 0x12, 0x61, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74,
+	0x22, 0x39, 0x0a, 0x0b, 0x46, 0x61, 0x69, 0x6c, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x12,
+	0x2a, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x12, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0xbe, 0x02, 0x0a, 0x0e,
+	0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x12, 0x15,
+	0x0a, 0x06, 0x6a, 0x6f, 0x62, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x6a, 0x6f, 0x62, 0x49, 0x64, 0x12, 0x23, 0x0a, 0x0d, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63,
+	0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x69, 0x6e,
+	0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x4c, 0x0a, 0x0d, 0x61, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x27, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2e, 0x62, 0x61, 0x7a, 0x65, 0x6c, 0x2e,
+	0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e,
+	0x2e, 0x76, 0x32, 0x2e, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x52, 0x0c, 0x61, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x44, 0x69, 0x67, 0x65, 0x73, 0x74, 0x12, 0x3f, 0x0a, 0x06, 0x61, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64,
 	0x2e, 0x62, 0x61, 0x7a, 0x65, 0x6c, 0x2e, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65, 0x78,
 	0x65, 0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x32, 0x2e, 0x41, 0x63, 0x74, 0x69, 0x6f,
-	0x6e, 0x52, 0x03, 0x6a, 0x6f, 0x62, 0x32, 0x86, 0x01, 0x0a, 0x09, 0x53, 0x63, 0x68, 0x65, 0x64,
-	0x75, 0x6c, 0x65, 0x72, 0x12, 0x40, 0x0a, 0x09, 0x48, 0x65, 0x61, 0x72, 0x74, 0x42, 0x65, 0x61,
-	0x74, 0x12, 0x17, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x48, 0x65,
-	0x61, 0x72, 0x74, 0x42, 0x65, 0x61, 0x74, 0x52, 0x65, 0x71, 0x1a, 0x18, 0x2e, 0x73, 0x63, 0x68,
-	0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x48, 0x65, 0x61, 0x72, 0x74, 0x42, 0x65, 0x61, 0x74,
-	0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12, 0x37, 0x0a, 0x06, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62,
-	0x12, 0x14, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x47, 0x65, 0x74,
-	0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x1a, 0x15, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c,
-	0x65, 0x72, 0x2e, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x42,
-	0x38, 0x5a, 0x36, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x64, 0x61,
-	0x73, 0x68, 0x6a, 0x61, 0x79, 0x2f, 0x62, 0x61, 0x69, 0x7a, 0x65, 0x2f, 0x70, 0x6b, 0x67, 0x2f,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x3b,
-	0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x6e, 0x52, 0x06, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72, 0x69,
+	0x6f, 0x72, 0x69, 0x74, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x70, 0x72, 0x69,
+	0x6f, 0x72, 0x69, 0x74, 0x79, 0x12, 0x45, 0x0a, 0x08, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72,
+	0x6d, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x29, 0x2e, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2e,
+	0x62, 0x61, 0x7a, 0x65, 0x6c, 0x2e, 0x72, 0x65, 0x6d, 0x6f, 0x74, 0x65, 0x2e, 0x65, 0x78, 0x65,
+	0x63, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x76, 0x32, 0x2e, 0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f,
+	0x72, 0x6d, 0x52, 0x08, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x22, 0x3d, 0x0a, 0x0f,
+	0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x12,
+	0x2a, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x12, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0x74, 0x0a, 0x0e, 0x57,
+	0x72, 0x69, 0x74, 0x65, 0x4a, 0x6f, 0x62, 0x4c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x12, 0x1f, 0x0a,
+	0x0b, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x6f, 0x72, 0x49, 0x64, 0x12, 0x15,
+	0x0a, 0x06, 0x6a, 0x6f, 0x62, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x6a, 0x6f, 0x62, 0x49, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x64, 0x65, 0x72, 0x72, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x73, 0x74, 0x64, 0x65, 0x72, 0x72, 0x12, 0x12, 0x0a,
+	0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74,
+	0x61, 0x22, 0x3d, 0x0a, 0x0f, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4a, 0x6f, 0x62, 0x4c, 0x6f, 0x67,
+	0x52, 0x65, 0x73, 0x70, 0x12, 0x2a, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x32, 0x96, 0x03, 0x0a, 0x09, 0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x12, 0x40,
+	0x0a, 0x09, 0x48, 0x65, 0x61, 0x72, 0x74, 0x42, 0x65, 0x61, 0x74, 0x12, 0x17, 0x2e, 0x73, 0x63,
+	0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x48, 0x65, 0x61, 0x72, 0x74, 0x42, 0x65, 0x61,
+	0x74, 0x52, 0x65, 0x71, 0x1a, 0x18, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72,
+	0x2e, 0x48, 0x65, 0x61, 0x72, 0x74, 0x42, 0x65, 0x61, 0x74, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00,
+	0x12, 0x37, 0x0a, 0x06, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x12, 0x14, 0x2e, 0x73, 0x63, 0x68,
+	0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71,
+	0x1a, 0x15, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x47, 0x65, 0x74,
+	0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12, 0x40, 0x0a, 0x09, 0x46, 0x69, 0x6e,
+	0x69, 0x73, 0x68, 0x4a, 0x6f, 0x62, 0x12, 0x17, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c,
+	0x65, 0x72, 0x2e, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x1a,
+	0x18, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x46, 0x69, 0x6e, 0x69,
+	0x73, 0x68, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12, 0x3a, 0x0a, 0x07, 0x46,
+	0x61, 0x69, 0x6c, 0x4a, 0x6f, 0x62, 0x12, 0x15, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c,
+	0x65, 0x72, 0x2e, 0x46, 0x61, 0x69, 0x6c, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x1a, 0x16, 0x2e,
+	0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x46, 0x61, 0x69, 0x6c, 0x4a, 0x6f,
+	0x62, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12, 0x46, 0x0a, 0x0b, 0x53, 0x63, 0x68, 0x65, 0x64,
+	0x75, 0x6c, 0x65, 0x4a, 0x6f, 0x62, 0x12, 0x19, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c,
+	0x65, 0x72, 0x2e, 0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x4a, 0x6f, 0x62, 0x52, 0x65,
+	0x71, 0x1a, 0x1a, 0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x53, 0x63,
+	0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x12,
+	0x48, 0x0a, 0x0b, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4a, 0x6f, 0x62, 0x4c, 0x6f, 0x67, 0x12, 0x19,
+	0x2e, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65,
+	0x4a, 0x6f, 0x62, 0x4c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x1a, 0x1a, 0x2e, 0x73, 0x63, 0x68, 0x65,
+	0x64, 0x75, 0x6c, 0x65, 0x72, 0x2e, 0x57, 0x72, 0x69, 0x74, 0x65, 0x4a, 0x6f, 0x62, 0x4c, 0x6f,
+	0x67, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x28, 0x01, 0x42, 0x38, 0x5a, 0x36, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x64, 0x61, 0x73, 0x68, 0x6a, 0x61, 0x79, 0x2f,
+	0x62, 0x61, 0x69, 0x7a, 0x65, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f,
+	0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x72, 0x3b, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75,
+	0x6c, 0x65, 0x72, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -337,29 +990,62 @@ func file_pkg_proto_scheduler_scheduler_proto_rawDescGZIP() []byte {
 	return file_pkg_proto_scheduler_scheduler_proto_rawDescData
 }
 
-var file_pkg_proto_scheduler_scheduler_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_pkg_proto_scheduler_scheduler_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_pkg_proto_scheduler_scheduler_proto_goTypes = []interface{}{
-	(*Property)(nil),      // 0: scheduler.Property
-	(*HeartBeatReq)(nil),  // 1: scheduler.HeartBeatReq
-	(*HeartBeatResp)(nil), // 2: scheduler.HeartBeatResp
-	(*GetJobReq)(nil),     // 3: scheduler.GetJobReq
-	(*GetJobResp)(nil),    // 4: scheduler.GetJobResp
-	(*status.Status)(nil), // 5: google.rpc.Status
-	(*v2.Action)(nil),     // 6: build.bazel.remote.execution.v2.Action
+	(*Property)(nil),                  // 0: scheduler.Property
+	(*HeartBeatReq)(nil),              // 1: scheduler.HeartBeatReq
+	(*HeartBeatResp)(nil),             // 2: scheduler.HeartBeatResp
+	(*GetJobReq)(nil),                 // 3: scheduler.GetJobReq
+	(*GetJobResp)(nil),                // 4: scheduler.GetJobResp
+	(*FinishJobReq)(nil),              // 5: scheduler.FinishJobReq
+	(*FinishJobResp)(nil),             // 6: scheduler.FinishJobResp
+	(*FailJobReq)(nil),                // 7: scheduler.FailJobReq
+	(*FailJobResp)(nil),               // 8: scheduler.FailJobResp
+	(*ScheduleJobReq)(nil),            // 9: scheduler.ScheduleJobReq
+	(*ScheduleJobResp)(nil),           // 10: scheduler.ScheduleJobResp
+	(*WriteJobLogReq)(nil),            // 11: scheduler.WriteJobLogReq
+	(*WriteJobLogResp)(nil),           // 12: scheduler.WriteJobLogResp
+	(*v2.Platform)(nil),               // 13: build.bazel.remote.execution.v2.Platform
+	(*status.Status)(nil),             // 14: google.rpc.Status
+	(*v2.Action)(nil),                 // 15: build.bazel.remote.execution.v2.Action
+	(*v2.Digest)(nil),                 // 16: build.bazel.remote.execution.v2.Digest
+	(*v2.ExecutedActionMetadata)(nil), // 17: build.bazel.remote.execution.v2.ExecutedActionMetadata
 }
 var file_pkg_proto_scheduler_scheduler_proto_depIdxs = []int32{
-	0, // 0: scheduler.HeartBeatReq.executor_info:type_name -> scheduler.Property
-	5, // 1: scheduler.HeartBeatResp.status:type_name -> google.rpc.Status
-	6, // 2: scheduler.GetJobResp.job:type_name -> build.bazel.remote.execution.v2.Action
-	1, // 3: scheduler.Scheduler.HeartBeat:input_type -> scheduler.HeartBeatReq
-	3, // 4: scheduler.Scheduler.GetJob:input_type -> scheduler.GetJobReq
-	2, // 5: scheduler.Scheduler.HeartBeat:output_type -> scheduler.HeartBeatResp
-	4, // 6: scheduler.Scheduler.GetJob:output_type -> scheduler.GetJobResp
-	5, // [5:7] is the sub-list for method output_type
-	3, // [3:5] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	13, // 0: scheduler.Property.platform:type_name -> build.bazel.remote.execution.v2.Platform
+	0,  // 1: scheduler.HeartBeatReq.executor_info:type_name -> scheduler.Property
+	14, // 2: scheduler.HeartBeatResp.status:type_name -> google.rpc.Status
+	15, // 3: scheduler.GetJobResp.job:type_name -> build.bazel.remote.execution.v2.Action
+	16, // 4: scheduler.GetJobResp.action_digest:type_name -> build.bazel.remote.execution.v2.Digest
+	13, // 5: scheduler.GetJobResp.platform:type_name -> build.bazel.remote.execution.v2.Platform
+	16, // 6: scheduler.FinishJobReq.action_result_digest:type_name -> build.bazel.remote.execution.v2.Digest
+	17, // 7: scheduler.FinishJobReq.execution_metadata:type_name -> build.bazel.remote.execution.v2.ExecutedActionMetadata
+	14, // 8: scheduler.FinishJobResp.status:type_name -> google.rpc.Status
+	14, // 9: scheduler.FailJobReq.status:type_name -> google.rpc.Status
+	16, // 10: scheduler.FailJobReq.action_result_digest:type_name -> build.bazel.remote.execution.v2.Digest
+	14, // 11: scheduler.FailJobResp.status:type_name -> google.rpc.Status
+	16, // 12: scheduler.ScheduleJobReq.action_digest:type_name -> build.bazel.remote.execution.v2.Digest
+	15, // 13: scheduler.ScheduleJobReq.action:type_name -> build.bazel.remote.execution.v2.Action
+	13, // 14: scheduler.ScheduleJobReq.platform:type_name -> build.bazel.remote.execution.v2.Platform
+	14, // 15: scheduler.ScheduleJobResp.status:type_name -> google.rpc.Status
+	14, // 16: scheduler.WriteJobLogResp.status:type_name -> google.rpc.Status
+	1,  // 17: scheduler.Scheduler.HeartBeat:input_type -> scheduler.HeartBeatReq
+	3,  // 18: scheduler.Scheduler.GetJob:input_type -> scheduler.GetJobReq
+	5,  // 19: scheduler.Scheduler.FinishJob:input_type -> scheduler.FinishJobReq
+	7,  // 20: scheduler.Scheduler.FailJob:input_type -> scheduler.FailJobReq
+	9,  // 21: scheduler.Scheduler.ScheduleJob:input_type -> scheduler.ScheduleJobReq
+	11, // 22: scheduler.Scheduler.WriteJobLog:input_type -> scheduler.WriteJobLogReq
+	2,  // 23: scheduler.Scheduler.HeartBeat:output_type -> scheduler.HeartBeatResp
+	4,  // 24: scheduler.Scheduler.GetJob:output_type -> scheduler.GetJobResp
+	6,  // 25: scheduler.Scheduler.FinishJob:output_type -> scheduler.FinishJobResp
+	8,  // 26: scheduler.Scheduler.FailJob:output_type -> scheduler.FailJobResp
+	10, // 27: scheduler.Scheduler.ScheduleJob:output_type -> scheduler.ScheduleJobResp
+	12, // 28: scheduler.Scheduler.WriteJobLog:output_type -> scheduler.WriteJobLogResp
+	23, // [23:29] is the sub-list for method output_type
+	17, // [17:23] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	17, // [17:17] is the sub-list for extension extendee
+	0,  // [0:17] is the sub-list for field type_name
 }
 
 func init() { file_pkg_proto_scheduler_scheduler_proto_init() }
@@ -428,6 +1114,102 @@ func file_pkg_proto_scheduler_scheduler_proto_init() {
 				return nil
 			}
 		}
+		file_pkg_proto_scheduler_scheduler_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FinishJobReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_proto_scheduler_scheduler_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FinishJobResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_proto_scheduler_scheduler_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FailJobReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_proto_scheduler_scheduler_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FailJobResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_proto_scheduler_scheduler_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScheduleJobReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_proto_scheduler_scheduler_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScheduleJobResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_proto_scheduler_scheduler_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WriteJobLogReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pkg_proto_scheduler_scheduler_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*WriteJobLogResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -435,7 +1217,7 @@ func file_pkg_proto_scheduler_scheduler_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_pkg_proto_scheduler_scheduler_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -463,6 +1245,11 @@ const _ = grpc.SupportPackageIsVersion6
 type SchedulerClient interface {
 	HeartBeat(ctx context.Context, in *HeartBeatReq, opts ...grpc.CallOption) (*HeartBeatResp, error)
 	GetJob(ctx context.Context, in *GetJobReq, opts ...grpc.CallOption) (*GetJobResp, error)
+	FinishJob(ctx context.Context, in *FinishJobReq, opts ...grpc.CallOption) (*FinishJobResp, error)
+	FailJob(ctx context.Context, in *FailJobReq, opts ...grpc.CallOption) (*FailJobResp, error)
+	ScheduleJob(ctx context.Context, in *ScheduleJobReq, opts ...grpc.CallOption) (*ScheduleJobResp, error)
+	// WriteJobLog forwards outputs of the command of running jobs as they are written
+	WriteJobLog(ctx context.Context, opts ...grpc.CallOption) (Scheduler_WriteJobLogClient, error)
 }
 
 type schedulerClient struct {
@@ -491,10 +1278,76 @@ func (c *schedulerClient) GetJob(ctx context.Context, in *GetJobReq, opts ...grp
 	return out, nil
 }
 
+func (c *schedulerClient) FinishJob(ctx context.Context, in *FinishJobReq, opts ...grpc.CallOption) (*FinishJobResp, error) {
+	out := new(FinishJobResp)
+	err := c.cc.Invoke(ctx, "/scheduler.Scheduler/FinishJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) FailJob(ctx context.Context, in *FailJobReq, opts ...grpc.CallOption) (*FailJobResp, error) {
+	out := new(FailJobResp)
+	err := c.cc.Invoke(ctx, "/scheduler.Scheduler/FailJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) ScheduleJob(ctx context.Context, in *ScheduleJobReq, opts ...grpc.CallOption) (*ScheduleJobResp, error) {
+	out := new(ScheduleJobResp)
+	err := c.cc.Invoke(ctx, "/scheduler.Scheduler/ScheduleJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *schedulerClient) WriteJobLog(ctx context.Context, opts ...grpc.CallOption) (Scheduler_WriteJobLogClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Scheduler_serviceDesc.Streams[0], "/scheduler.Scheduler/WriteJobLog", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &schedulerWriteJobLogClient{stream}
+	return x, nil
+}
+
+type Scheduler_WriteJobLogClient interface {
+	Send(*WriteJobLogReq) error
+	CloseAndRecv() (*WriteJobLogResp, error)
+	grpc.ClientStream
+}
+
+type schedulerWriteJobLogClient struct {
+	grpc.ClientStream
+}
+
+func (x *schedulerWriteJobLogClient) Send(m *WriteJobLogReq) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *schedulerWriteJobLogClient) CloseAndRecv() (*WriteJobLogResp, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(WriteJobLogResp)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // SchedulerServer is the server API for Scheduler service.
 type SchedulerServer interface {
 	HeartBeat(context.Context, *HeartBeatReq) (*HeartBeatResp, error)
 	GetJob(context.Context, *GetJobReq) (*GetJobResp, error)
+	FinishJob(context.Context, *FinishJobReq) (*FinishJobResp, error)
+	FailJob(context.Context, *FailJobReq) (*FailJobResp, error)
+	ScheduleJob(context.Context, *ScheduleJobReq) (*ScheduleJobResp, error)
+	// WriteJobLog forwards outputs of the command of running jobs as they are written
+	WriteJobLog(Scheduler_WriteJobLogServer) error
 }
 
 // UnimplementedSchedulerServer can be embedded to have forward compatible implementations.
@@ -507,6 +1360,18 @@ func (*UnimplementedSchedulerServer) HeartBeat(context.Context, *HeartBeatReq) (
 func (*UnimplementedSchedulerServer) GetJob(context.Context, *GetJobReq) (*GetJobResp, error) {
 	return nil, status1.Errorf(codes.Unimplemented, "method GetJob not implemented")
 }
+func (*UnimplementedSchedulerServer) FinishJob(context.Context, *FinishJobReq) (*FinishJobResp, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method FinishJob not implemented")
+}
+func (*UnimplementedSchedulerServer) FailJob(context.Context, *FailJobReq) (*FailJobResp, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method FailJob not implemented")
+}
+func (*UnimplementedSchedulerServer) ScheduleJob(context.Context, *ScheduleJobReq) (*ScheduleJobResp, error) {
+	return nil, status1.Errorf(codes.Unimplemented, "method ScheduleJob not implemented")
+}
+func (*UnimplementedSchedulerServer) WriteJobLog(Scheduler_WriteJobLogServer) error {
+	return status1.Errorf(codes.Unimplemented, "method WriteJobLog not implemented")
+}
 
 func RegisterSchedulerServer(s *grpc.Server, srv SchedulerServer) {
 	s.RegisterService(&_Scheduler_serviceDesc, srv)
@@ -548,6 +1413,86 @@ func _Scheduler_GetJob_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Scheduler_FinishJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FinishJobReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).FinishJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scheduler.Scheduler/FinishJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).FinishJob(ctx, req.(*FinishJobReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_FailJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FailJobReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).FailJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scheduler.Scheduler/FailJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).FailJob(ctx, req.(*FailJobReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_ScheduleJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScheduleJobReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SchedulerServer).ScheduleJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/scheduler.Scheduler/ScheduleJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SchedulerServer).ScheduleJob(ctx, req.(*ScheduleJobReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Scheduler_WriteJobLog_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SchedulerServer).WriteJobLog(&schedulerWriteJobLogServer{stream})
+}
+
+type Scheduler_WriteJobLogServer interface {
+	SendAndClose(*WriteJobLogResp) error
+	Recv() (*WriteJobLogReq, error)
+	grpc.ServerStream
+}
+
+type schedulerWriteJobLogServer struct {
+	grpc.ServerStream
+}
+
+func (x *schedulerWriteJobLogServer) SendAndClose(m *WriteJobLogResp) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *schedulerWriteJobLogServer) Recv() (*WriteJobLogReq, error) {
+	m := new(WriteJobLogReq)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Scheduler_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "scheduler.Scheduler",
 	HandlerType: (*SchedulerServer)(nil),
@@ -560,7 +1505,25 @@ var _Scheduler_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetJob",
 			Handler:    _Scheduler_GetJob_Handler,
 		},
+		{
+			MethodName: "FinishJob",
+			Handler:    _Scheduler_FinishJob_Handler,
+		},
+		{
+			MethodName: "FailJob",
+			Handler:    _Scheduler_FailJob_Handler,
+		},
+		{
+			MethodName: "ScheduleJob",
+			Handler:    _Scheduler_ScheduleJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WriteJobLog",
+			Handler:       _Scheduler_WriteJobLog_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "pkg/proto/scheduler/scheduler.proto",
 }
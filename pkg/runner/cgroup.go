@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// cpuPeriod is the period of cpu.max in microseconds
+const cpuPeriod = 100000
+
+// controllers returns the cgroup v2 controllers required by limits of the sandbox
+func (s *sandbox) controllers() []string {
+	var controllers []string
+	if s.cpus > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if s.memoryBytes > 0 {
+		controllers = append(controllers, "memory")
+	}
+	return controllers
+}
+
+// enableControllers creates cgroupDir and enables controllers for cgroups of actions in it
+func (s *sandbox) enableControllers() error {
+	if err := os.MkdirAll(s.cgroupDir, os.ModePerm); err != nil {
+		return status.FailedPreconditionErrorf("fail to create cgroup %s: %s", s.cgroupDir, err)
+	}
+	available, err := ioutil.ReadFile(filepath.Join(s.cgroupDir, "cgroup.controllers"))
+	if err != nil {
+		return status.FailedPreconditionErrorf("%s is not a cgroup v2 directory: %s", s.cgroupDir, err)
+	}
+	var enable []string
+	for _, controller := range s.controllers() {
+		found := false
+		for _, c := range strings.Fields(string(available)) {
+			if c == controller {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return status.FailedPreconditionErrorf("controller %s is not available in cgroup %s", controller, s.cgroupDir)
+		}
+		enable = append(enable, "+"+controller)
+	}
+	if len(enable) == 0 {
+		return nil
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.cgroupDir, "cgroup.subtree_control"), []byte(strings.Join(enable, " ")), 0644); err != nil {
+		return status.FailedPreconditionErrorf("fail to enable controllers %v in cgroup %s: %s", enable, s.cgroupDir, err)
+	}
+	return nil
+}
+
+// cgroup holds processes of an action
+type cgroup struct {
+	dir string
+}
+
+// newCgroup creates a cgroup with limits of the sandbox for an action
+func (s *sandbox) newCgroup() (*cgroup, error) {
+	c := &cgroup{dir: filepath.Join(s.cgroupDir, uuid.New().String())}
+	if err := os.Mkdir(c.dir, os.ModePerm); err != nil {
+		return nil, status.UnavailableErrorf("fail to create cgroup %s: %s", c.dir, err)
+	}
+	if s.cpus > 0 {
+		if err := c.write("cpu.max", fmt.Sprintf("%d %d", int64(s.cpus*cpuPeriod), cpuPeriod)); err != nil {
+			c.remove()
+			return nil, err
+		}
+	}
+	if s.memoryBytes > 0 {
+		if err := c.write("memory.max", strconv.FormatInt(s.memoryBytes, 10)); err != nil {
+			c.remove()
+			return nil, err
+		}
+		// memory.swap.max only exists if swap is enabled
+		_ = c.write("memory.swap.max", "0")
+	}
+	return c, nil
+}
+
+func (c *cgroup) write(file, value string) error {
+	if err := ioutil.WriteFile(filepath.Join(c.dir, file), []byte(value), 0644); err != nil {
+		return status.UnavailableErrorf("fail to write %s to %s of cgroup %s: %s", value, file, c.dir, err)
+	}
+	return nil
+}
+
+// add moves process pid into the cgroup
+func (c *cgroup) add(pid int) error {
+	return c.write("cgroup.procs", strconv.Itoa(pid))
+}
+
+// oomKilled reports whether any process in the cgroup was killed by the OOM killer
+func (c *cgroup) oomKilled() bool {
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, "memory.events"))
+	if err != nil {
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.ParseInt(fields[1], 10, 64)
+			return n > 0
+		}
+	}
+	return false
+}
+
+// remove kills processes left in the cgroup and removes it
+func (c *cgroup) remove() {
+	// cgroup.kill only exists since Linux 5.14, processes left are killed with the pid namespace anyway
+	_ = c.write("cgroup.kill", "1")
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = os.Remove(c.dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(time.Duration(i+1) * 10 * time.Millisecond)
+	}
+	logrus.Warnf("fail to remove cgroup %s: %s", c.dir, err)
+}
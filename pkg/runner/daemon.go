@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils/commandutil"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// daemonErrorExitCode is returned by docker run and podman run if the container could not be created,
+// commands run in containers may exit with it as well, so the daemon failed only if no container was created.
+const daemonErrorExitCode = 125
+
+// daemonRunner runs commands in containers created by a local container daemon through its cli,
+// the exec root is mounted at the same path in containers, so work_dir must be visible to the daemon.
+type daemonRunner struct {
+	binary string
+}
+
+func (r *daemonRunner) run(ctx context.Context, image string, network bool, command *repb.Command, execRoot, workDir string, stdout, stderr io.Writer) *interfaces.CommandResult {
+	name := "baize-" + uuid.New().String()
+	// the daemon writes id of the container into cidFile once it is created
+	cidFile := execRoot + ".cid"
+	_ = os.Remove(cidFile)
+	defer os.Remove(cidFile)
+	result := commandutil.Run(ctx, &repb.Command{Arguments: r.runArgs(name, cidFile, image, network, command, execRoot, workDir)}, "", &bytes.Buffer{}, stdout, stderr)
+	// the container is run by the daemon, resources used by the cli say nothing about it
+	result.UsageStats = nil
+	if ctx.Err() != nil {
+		// killing the cli does not stop the container
+		if out, err := exec.Command(r.binary, "rm", "-f", name).CombinedOutput(); err != nil {
+			logrus.WithError(err).Warnf("remove container %s: %s", name, out)
+		}
+	}
+	if result.Error == nil && result.ExitCode == daemonErrorExitCode && !created(cidFile) {
+		result.Error = status.UnavailableErrorf("create container of image %s error: %s", image, result.Stderr)
+	}
+	return result
+}
+
+// created reports whether the daemon created the container, which has written its id into cidFile
+func created(cidFile string) bool {
+	info, err := os.Stat(cidFile)
+	return err == nil && info.Size() > 0
+}
+
+func (r *daemonRunner) runArgs(name, cidFile, image string, network bool, command *repb.Command, execRoot, workDir string) []string {
+	args := []string{
+		r.binary, "run", "--rm",
+		"--name", name,
+		"--cidfile", cidFile,
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"--volume", execRoot + ":" + execRoot,
+		"--workdir", workDir,
+	}
+	if !network {
+		args = append(args, "--network", "none")
+	}
+	for _, env := range command.GetEnvironmentVariables() {
+		args = append(args, "--env", env.GetName()+"="+env.GetValue())
+	}
+	args = append(args, image)
+	return append(args, command.GetArguments()...)
+}
@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils/commandutil"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+const (
+	ociVersion  = "1.0.2"
+	defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// ociRunner runs commands with an OCI runtime such as runc or crun. Images are not pulled,
+// the root filesystem of image docker://gcr.io/project/image:tag should be unpacked at
+// <rootfs_dir>/gcr.io/project/image:tag in advance.
+type ociRunner struct {
+	binary    string
+	rootfsDir string
+}
+
+// ociSpec is the subset of OCI runtime spec used to run actions
+type ociSpec struct {
+	Version  string     `json:"ociVersion"`
+	Process  ociProcess `json:"process"`
+	Root     ociRoot    `json:"root"`
+	Hostname string     `json:"hostname"`
+	Mounts   []ociMount `json:"mounts"`
+	Linux    ociLinux   `json:"linux"`
+}
+
+type ociProcess struct {
+	User            ociUser  `json:"user"`
+	Args            []string `json:"args"`
+	Env             []string `json:"env"`
+	Cwd             string   `json:"cwd"`
+	NoNewPrivileges bool     `json:"noNewPrivileges"`
+}
+
+type ociUser struct {
+	UID uint32 `json:"uid"`
+	GID uint32 `json:"gid"`
+}
+
+type ociRoot struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly"`
+}
+
+type ociMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type ociLinux struct {
+	Namespaces    []ociNamespace `json:"namespaces"`
+	MaskedPaths   []string       `json:"maskedPaths"`
+	ReadonlyPaths []string       `json:"readonlyPaths"`
+}
+
+type ociNamespace struct {
+	Type string `json:"type"`
+}
+
+func (r *ociRunner) rootfs(image string) (string, error) {
+	rootfs := filepath.Join(r.rootfsDir, image)
+	if !strings.HasPrefix(rootfs, filepath.Clean(r.rootfsDir)+string(filepath.Separator)) {
+		return "", status.InvalidArgumentErrorf("invalid container-image %s", image)
+	}
+	if info, err := os.Stat(rootfs); err != nil || !info.IsDir() {
+		return "", status.FailedPreconditionErrorf("rootfs of image %s is not unpacked at %s", image, rootfs)
+	}
+	return rootfs, nil
+}
+
+// spec returns the OCI runtime spec which runs command in rootfs with execRoot mounted at the same path
+func (r *ociRunner) spec(rootfs string, network bool, command *repb.Command, execRoot, workDir string) *ociSpec {
+	env := commandutil.EnvStringList(command)
+	hasPath := false
+	for _, e := range env {
+		if strings.HasPrefix(e, "PATH=") {
+			hasPath = true
+		}
+	}
+	if !hasPath {
+		env = append(env, defaultPath)
+	}
+	namespaces := []ociNamespace{{Type: "pid"}, {Type: "ipc"}, {Type: "uts"}, {Type: "mount"}}
+	if !network {
+		namespaces = append(namespaces, ociNamespace{Type: "network"})
+	}
+	return &ociSpec{
+		Version: ociVersion,
+		Process: ociProcess{
+			User:            ociUser{UID: uint32(os.Getuid()), GID: uint32(os.Getgid())},
+			Args:            command.GetArguments(),
+			Env:             env,
+			Cwd:             workDir,
+			NoNewPrivileges: true,
+		},
+		Root:     ociRoot{Path: rootfs, Readonly: true},
+		Hostname: "localhost",
+		Mounts: []ociMount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+			{Destination: "/dev/pts", Type: "devpts", Source: "devpts", Options: []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620"}},
+			{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+			{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"nosuid", "noexec", "nodev", "ro"}},
+			{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "nodev", "mode=1777"}},
+			{Destination: execRoot, Type: "bind", Source: execRoot, Options: []string{"rbind", "rw"}},
+		},
+		Linux: ociLinux{
+			Namespaces:    namespaces,
+			MaskedPaths:   []string{"/proc/kcore", "/proc/keys", "/proc/timer_list", "/sys/firmware"},
+			ReadonlyPaths: []string{"/proc/bus", "/proc/fs", "/proc/irq", "/proc/sys", "/proc/sysrq-trigger"},
+		},
+	}
+}
+
+func (r *ociRunner) run(ctx context.Context, image string, network bool, command *repb.Command, execRoot, workDir string, stdout, stderr io.Writer) *interfaces.CommandResult {
+	rootfs, err := r.rootfs(image)
+	if err != nil {
+		return commandutil.ErrorResult(err)
+	}
+	bundle, err := ioutil.TempDir("", "baize-bundle-")
+	if err != nil {
+		return commandutil.ErrorResult(err)
+	}
+	defer os.RemoveAll(bundle)
+	data, err := json.Marshal(r.spec(rootfs, network, command, execRoot, workDir))
+	if err != nil {
+		return commandutil.ErrorResult(status.InternalErrorf("marshal oci spec error: %s", err))
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundle, "config.json"), data, 0644); err != nil {
+		return commandutil.ErrorResult(err)
+	}
+	id := "baize-" + uuid.New().String()
+	result := commandutil.Run(ctx, &repb.Command{Arguments: []string{r.binary, "run", "--bundle", bundle, id}}, "", &bytes.Buffer{}, stdout, stderr)
+	if ctx.Err() != nil {
+		// the container may survive the runtime process killed
+		if out, err := exec.Command(r.binary, "delete", "--force", id).CombinedOutput(); err != nil {
+			logrus.WithError(err).Debugf("delete container %s: %s", id, out)
+		}
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+// Package runner provides command runners which run actions on the host, in sandboxes or in containers.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils/commandutil"
+	"github.com/dashjay/baize/pkg/utils/platform"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+const (
+	// container runtimes supported by container_runtime
+	runtimeDocker = "docker"
+	runtimePodman = "podman"
+	runtimeRunc   = "runc"
+	runtimeCrun   = "crun"
+
+	// dockerImagePrefix is the scheme of container-image used by bazel
+	dockerImagePrefix = "docker://"
+	// standardNetwork is the value of dockerNetwork for actions requiring network
+	standardNetwork = "standard"
+)
+
+// Runners chooses the runner of an action by its container-image platform property,
+// actions without container-image are run on the host.
+type Runners struct {
+	host interfaces.CommandRunner
+	// sandbox runs actions without container-image instead of host if sandbox is enabled
+	sandbox *sandbox
+	// container is nil if container_runtime is not configured
+	container containerRunner
+}
+
+// New returns Runners with the container runtime configured
+func New(cfg *config.ExecutorConfig) (*Runners, error) {
+	r := &Runners{host: &hostRunner{}}
+	if cfg.Sandbox != nil && cfg.Sandbox.Enabled {
+		s, err := newSandbox(cfg.Sandbox)
+		if err != nil {
+			return nil, err
+		}
+		r.sandbox = s
+	}
+	if cfg.ContainerRuntime == "" {
+		return r, nil
+	}
+	binary, err := exec.LookPath(cfg.ContainerRuntime)
+	if err != nil {
+		return nil, status.FailedPreconditionErrorf("container runtime %s not found: %s", cfg.ContainerRuntime, err)
+	}
+	switch cfg.ContainerRuntime {
+	case runtimeDocker, runtimePodman:
+		r.container = &daemonRunner{binary: binary}
+	case runtimeRunc, runtimeCrun:
+		if cfg.RootfsDir == "" {
+			return nil, status.InvalidArgumentErrorf("rootfs_dir is required by container runtime %s", cfg.ContainerRuntime)
+		}
+		r.container = &ociRunner{binary: binary, rootfsDir: cfg.RootfsDir}
+	default:
+		return nil, status.InvalidArgumentErrorf("unknown container runtime %s", cfg.ContainerRuntime)
+	}
+	return r, nil
+}
+
+// Get returns the runner of an action with platform p
+func (r *Runners) Get(p *repb.Platform) (interfaces.CommandRunner, error) {
+	image := containerImage(p)
+	network := platform.Get(p, platform.DockerNetwork) == standardNetwork
+	if image == "" {
+		if r.sandbox != nil {
+			return &sandboxRunner{sandbox: r.sandbox, network: network}, nil
+		}
+		return r.host, nil
+	}
+	if r.container == nil {
+		return nil, status.FailedPreconditionErrorf("container-image %s is required but no container runtime configured", image)
+	}
+	return &imageRunner{runner: r.container, image: image, network: network}, nil
+}
+
+// containerImage returns container-image of platform without the docker:// scheme
+func containerImage(p *repb.Platform) string {
+	return strings.TrimPrefix(platform.Get(p, platform.ContainerImage), dockerImagePrefix)
+}
+
+// containerRunner runs commands in containers of image
+type containerRunner interface {
+	run(ctx context.Context, image string, network bool, command *repb.Command, execRoot, workDir string, stdout, stderr io.Writer) *interfaces.CommandResult
+}
+
+// imageRunner binds the image and network required by an action to a container runner
+type imageRunner struct {
+	runner  containerRunner
+	image   string
+	network bool
+}
+
+func (r *imageRunner) Run(ctx context.Context, command *repb.Command, execRoot, workDir string, stdout, stderr io.Writer) *interfaces.CommandResult {
+	return r.runner.run(ctx, r.image, r.network, command, execRoot, workDir, stdout, stderr)
+}
+
+// hostRunner runs commands directly on the host
+type hostRunner struct{}
+
+func (r *hostRunner) Run(ctx context.Context, command *repb.Command, execRoot, workDir string, stdout, stderr io.Writer) *interfaces.CommandResult {
+	return commandutil.Run(ctx, command, workDir, &bytes.Buffer{}, stdout, stderr)
+}
@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/utils/platform"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+func newPlatform(kvs ...string) *repb.Platform {
+	p := &repb.Platform{}
+	for i := 0; i < len(kvs); i += 2 {
+		p.Properties = append(p.Properties, &repb.Platform_Property{Name: kvs[i], Value: kvs[i+1]})
+	}
+	return p
+}
+
+func TestGetRunner(t *testing.T) {
+	r, err := New(&config.ExecutorConfig{})
+	assert.Nil(t, err)
+	host, err := r.Get(newPlatform(platform.OSFamily, "linux"))
+	assert.Nil(t, err)
+	assert.IsType(t, &hostRunner{}, host)
+	_, err = r.Get(newPlatform(platform.ContainerImage, "docker://ubuntu:20.04"))
+	assert.True(t, status.IsFailedPreconditionError(err))
+
+	r.container = &daemonRunner{binary: "docker"}
+	container, err := r.Get(newPlatform(platform.ContainerImage, "docker://ubuntu:20.04", platform.DockerNetwork, "standard"))
+	assert.Nil(t, err)
+	assert.Equal(t, &imageRunner{runner: r.container, image: "ubuntu:20.04", network: true}, container)
+
+	_, err = New(&config.ExecutorConfig{ContainerRuntime: "unknown-runtime"})
+	assert.NotNil(t, err)
+}
+
+func TestHostRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runner-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	var stdout bytes.Buffer
+	result := (&hostRunner{}).Run(context.Background(), &repb.Command{Arguments: []string{"sh", "-c", "pwd; echo err >&2; exit 3"}}, dir, dir, &stdout, nil)
+	assert.Nil(t, result.Error)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "err\n", string(result.Stderr))
+	assert.Equal(t, string(result.Stdout), stdout.String())
+}
+
+func TestDaemonRunArgs(t *testing.T) {
+	r := &daemonRunner{binary: "docker"}
+	command := &repb.Command{
+		Arguments:            []string{"gcc", "-c", "a.c"},
+		EnvironmentVariables: []*repb.Command_EnvironmentVariable{{Name: "PATH", Value: "/usr/bin"}},
+	}
+	args := r.runArgs("name", "/work/action.cid", "ubuntu:20.04", false, command, "/work/action", "/work/action/src")
+	assert.Subset(t, args, []string{"--cidfile", "/work/action.cid", "--network", "none", "--volume", "/work/action:/work/action", "--workdir", "/work/action/src", "--env", "PATH=/usr/bin"})
+	assert.Equal(t, []string{"ubuntu:20.04", "gcc", "-c", "a.c"}, args[len(args)-4:])
+	assert.NotContains(t, r.runArgs("name", "/work/action.cid", "ubuntu:20.04", true, command, "/work/action", "/work/action"), "none")
+}
+
+func TestDaemonErrorExitCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	// the fake cli creates the container unless the image is missing, then exits with 125 either way
+	binary := filepath.Join(dir, "docker")
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--cidfile) cidfile="$2"; shift ;;
+	missing) exit 125 ;;
+	esac
+	shift
+done
+echo container-id > "$cidfile"
+exit 125
+`
+	assert.Nil(t, ioutil.WriteFile(binary, []byte(script), 0755))
+	r := &daemonRunner{binary: binary}
+	execRoot := filepath.Join(dir, "action")
+	assert.Nil(t, os.Mkdir(execRoot, os.ModePerm))
+	command := &repb.Command{Arguments: []string{"sh", "-c", "exit 125"}}
+
+	result := r.run(context.Background(), "missing", false, command, execRoot, execRoot, nil, nil)
+	assert.True(t, status.IsUnavailableError(result.Error))
+	// the command itself exited with 125
+	result = r.run(context.Background(), "ubuntu:20.04", false, command, execRoot, execRoot, nil, nil)
+	assert.Nil(t, result.Error)
+	assert.Equal(t, daemonErrorExitCode, result.ExitCode)
+	_, err = os.Stat(execRoot + ".cid")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOCISpec(t *testing.T) {
+	rootfsDir, err := ioutil.TempDir("", "rootfs-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(rootfsDir)
+	r := &ociRunner{binary: "runc", rootfsDir: rootfsDir}
+	_, err = r.rootfs("ubuntu:20.04")
+	assert.True(t, status.IsFailedPreconditionError(err))
+	assert.Nil(t, os.MkdirAll(filepath.Join(rootfsDir, "ubuntu:20.04"), os.ModePerm))
+	rootfs, err := r.rootfs("ubuntu:20.04")
+	assert.Nil(t, err)
+	_, err = r.rootfs("../escape")
+	assert.NotNil(t, err)
+
+	spec := r.spec(rootfs, false, &repb.Command{Arguments: []string{"true"}}, "/work/action", "/work/action/src")
+	assert.Equal(t, "/work/action/src", spec.Process.Cwd)
+	assert.Contains(t, spec.Process.Env, defaultPath)
+	assert.Contains(t, spec.Linux.Namespaces, ociNamespace{Type: "network"})
+	assert.Contains(t, spec.Mounts, ociMount{Destination: "/work/action", Type: "bind", Source: "/work/action", Options: []string{"rbind", "rw"}})
+	spec = r.spec(rootfs, true, &repb.Command{Arguments: []string{"true"}}, "/work/action", "/work/action")
+	assert.NotContains(t, spec.Linux.Namespaces, ociNamespace{Type: "network"})
+}
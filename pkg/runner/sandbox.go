@@ -0,0 +1,183 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	gstatus "google.golang.org/grpc/status"
+
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/interfaces"
+	"github.com/dashjay/baize/pkg/utils/commandutil"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+// sandbox runs commands in new Linux namespaces, limits CPU and memory of them by cgroup v2 if cgroupDir is set
+type sandbox struct {
+	cgroupDir   string
+	cpus        float64
+	memoryBytes int64
+}
+
+func newSandbox(cfg *config.SandboxConfig) (*sandbox, error) {
+	s := &sandbox{cgroupDir: cfg.CgroupDir, cpus: cfg.CPUs, memoryBytes: cfg.MemoryBytes}
+	if s.cgroupDir == "" {
+		if s.cpus > 0 || s.memoryBytes > 0 {
+			return nil, status.InvalidArgumentError("cgroup_dir is required to limit cpus and memory of sandboxes")
+		}
+	} else if err := s.enableControllers(); err != nil {
+		return nil, err
+	}
+	if err := s.check(); err != nil {
+		return nil, status.FailedPreconditionErrorf("sandbox is not usable: %s", status.Message(err))
+	}
+	return s, nil
+}
+
+// check runs true in a sandbox to find out whether namespaces are available to the executor
+func (s *sandbox) check() error {
+	dir, err := ioutil.TempDir("", "baize-sandbox-check-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	result := s.run(context.Background(), false, &repb.Command{Arguments: []string{"true"}}, dir, dir, nil, nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("true exited with %d: %s", result.ExitCode, result.Stderr)
+	}
+	return nil
+}
+
+// sandboxError is written to the error pipe by the init process if it fails to set up the sandbox
+type sandboxError struct {
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message"`
+}
+
+// readSandboxError reads the error pipe until it is closed on executing the command
+func readSandboxError(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return status.UnavailableErrorf("fail to read error of sandbox: %s", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	var e sandboxError
+	if err := json.Unmarshal(data, &e); err != nil {
+		return status.UnavailableErrorf("fail to set up sandbox: %s", data)
+	}
+	return gstatus.Error(e.Code, e.Message)
+}
+
+// sandboxProcAttr maps the uid and gid of the executor in the new user namespace,
+// the init process keeps capabilities required to set up mounts and network of the sandbox and to drop capabilities.
+func sandboxProcAttr(network bool) *syscall.SysProcAttr {
+	flags := unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID | unix.CLONE_NEWIPC | unix.CLONE_NEWUTS
+	if !network {
+		flags |= unix.CLONE_NEWNET
+	}
+	return &syscall.SysProcAttr{
+		Setpgid:     true,
+		Cloneflags:  uintptr(flags),
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+		AmbientCaps: []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_NET_ADMIN, unix.CAP_SETPCAP},
+	}
+}
+
+func (s *sandbox) run(ctx context.Context, network bool, command *repb.Command, execRoot, workDir string, stdout, stderr io.Writer) *interfaces.CommandResult {
+	if len(command.GetArguments()) == 0 {
+		return commandutil.ErrorResult(status.InvalidArgumentError("no arguments in command"))
+	}
+	root, err := ioutil.TempDir("", "baize-sandbox-")
+	if err != nil {
+		return commandutil.ErrorResult(status.UnavailableErrorf("fail to create root of sandbox: %s", err))
+	}
+	defer os.RemoveAll(root)
+	var cg *cgroup
+	if s.cgroupDir != "" {
+		if cg, err = s.newCgroup(); err != nil {
+			return commandutil.ErrorResult(err)
+		}
+		defer cg.remove()
+	}
+	specReader, specWriter, err := os.Pipe()
+	if err != nil {
+		return commandutil.ErrorResult(status.UnavailableErrorf("fail to create pipe: %s", err))
+	}
+	defer specReader.Close()
+	defer specWriter.Close()
+	errReader, errWriter, err := os.Pipe()
+	if err != nil {
+		return commandutil.ErrorResult(status.UnavailableErrorf("fail to create pipe: %s", err))
+	}
+	defer errReader.Close()
+	defer errWriter.Close()
+
+	// the executor itself is executed as the init process, which sets up the sandbox and executes the command
+	cmd, stdoutBuf, stderrBuf := commandutil.ConstructExecCommand(ctx, command, workDir, &bytes.Buffer{}, stdout, stderr)
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = append([]string{sandboxInitName}, command.GetArguments()...)
+	cmd.ExtraFiles = []*os.File{specReader, errWriter}
+	cmd.SysProcAttr = sandboxProcAttr(network)
+	spec := &sandboxSpec{Root: root, ExecRoot: execRoot, WorkDir: workDir, Network: network}
+
+	var setupErr error
+	err = commandutil.RunCmd(ctx, cmd, func() error {
+		specReader.Close()
+		errWriter.Close()
+		// the init process waits for the spec, so the command is run after being added to the cgroup
+		if cg != nil {
+			if setupErr = cg.add(cmd.Process.Pid); setupErr != nil {
+				return setupErr
+			}
+		}
+		if setupErr = json.NewEncoder(specWriter).Encode(spec); setupErr != nil {
+			setupErr = status.UnavailableErrorf("fail to send spec to sandbox: %s", setupErr)
+			return setupErr
+		}
+		specWriter.Close()
+		setupErr = readSandboxError(errReader)
+		return setupErr
+	})
+	result := &interfaces.CommandResult{
+		Stdout:             stdoutBuf.Bytes(),
+		Stderr:             stderrBuf.Bytes(),
+		CommandDebugString: fmt.Sprintf("(sandboxed) %s", strings.Join(command.GetArguments(), " ")),
+	}
+	if setupErr != nil {
+		result.ExitCode, result.Error = commandutil.NoExitCode, setupErr
+		return result
+	}
+	result.ExitCode, result.Error = commandutil.ExitCode(ctx, cmd, err)
+	// the init process executes the command, so usage of cmd is the usage of the command
+	result.UsageStats = commandutil.UsageStats(cmd)
+	if status.IsResourceExhaustedError(result.Error) && cg != nil && cg.oomKilled() {
+		result.Error = status.ResourceExhaustedErrorf("command `%s` was killed for exceeding the memory limit of %d bytes", result.CommandDebugString, s.memoryBytes)
+	}
+	return result
+}
+
+// sandboxRunner binds the network required by an action to the sandbox
+type sandboxRunner struct {
+	sandbox *sandbox
+	network bool
+}
+
+func (r *sandboxRunner) Run(ctx context.Context, command *repb.Command, execRoot, workDir string, stdout, stderr io.Writer) *interfaces.CommandResult {
+	return r.sandbox.run(ctx, r.network, command, execRoot, workDir, stdout, stderr)
+}
@@ -0,0 +1,285 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	gstatus "google.golang.org/grpc/status"
+
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+const (
+	// sandboxInitName is argv[0] of the executor executed as the init process of a sandbox
+	sandboxInitName = "baize-sandbox-init"
+	// sandboxSpecFd is the pipe the init process reads sandboxSpec from
+	sandboxSpecFd = 3
+	// sandboxErrorFd is the pipe the init process writes sandboxError to, it is closed on executing the command
+	sandboxErrorFd = 4
+)
+
+var (
+	// sandboxReadonlyDirs are directories of the host mounted read-only in sandboxes if existing
+	sandboxReadonlyDirs = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/libx32", "/etc"}
+	// sandboxDevices are devices of the host available in sandboxes
+	sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom", "/dev/tty"}
+)
+
+// sandboxSpec is sent to the init process of a sandbox
+type sandboxSpec struct {
+	// Root is an empty directory the new root filesystem is mounted on
+	Root     string `json:"root"`
+	ExecRoot string `json:"exec_root"`
+	WorkDir  string `json:"work_dir"`
+	Network  bool   `json:"network"`
+}
+
+// SandboxInit sets up the sandbox and executes the command if the process is the init process of a sandbox,
+// it returns immediately otherwise. It should be called at the beginning of main of binaries running actions.
+func SandboxInit() {
+	if len(os.Args) < 2 || os.Args[0] != sandboxInitName {
+		return
+	}
+	// capabilities are dropped by thread, the command should be executed by the same thread
+	runtime.LockOSThread()
+	err := sandboxInit(os.Args[1:])
+	s, _ := gstatus.FromError(err)
+	_ = json.NewEncoder(os.NewFile(sandboxErrorFd, "error")).Encode(&sandboxError{Code: s.Code(), Message: s.Message()})
+	os.Exit(1)
+}
+
+// sandboxInit only returns if it fails to set up the sandbox or execute the command
+func sandboxInit(args []string) error {
+	specPipe := os.NewFile(sandboxSpecFd, "spec")
+	var spec sandboxSpec
+	if err := json.NewDecoder(specPipe).Decode(&spec); err != nil {
+		return status.UnavailableErrorf("fail to read spec of sandbox: %s", err)
+	}
+	specPipe.Close()
+	unix.CloseOnExec(sandboxErrorFd)
+
+	if err := setupRootfs(&spec); err != nil {
+		return status.UnavailableErrorf("fail to set up root filesystem of sandbox: %s", err)
+	}
+	if err := unix.Sethostname([]byte("localhost")); err != nil {
+		return status.UnavailableErrorf("fail to set hostname of sandbox: %s", err)
+	}
+	if !spec.Network {
+		if err := setLoopbackUp(); err != nil {
+			return status.UnavailableErrorf("fail to set up loopback of sandbox: %s", err)
+		}
+	}
+	if err := os.Chdir(spec.WorkDir); err != nil {
+		return status.UnavailableErrorf("fail to change directory to %s: %s", spec.WorkDir, err)
+	}
+	path, err := lookPath(args[0])
+	if err != nil {
+		return status.NotFoundError(err.Error())
+	}
+	if err := dropCapabilities(); err != nil {
+		return status.UnavailableErrorf("fail to drop capabilities: %s", err)
+	}
+	err = syscall.Exec(path, args, os.Environ())
+	return status.UnavailableErrorf("fail to execute %s: %s", path, err)
+}
+
+// lookPath looks up file in PATH of the command like exec.Command in the host runner
+func lookPath(file string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	if _, exists := os.LookupEnv("PATH"); !exists {
+		defer os.Unsetenv("PATH")
+		os.Setenv("PATH", strings.TrimPrefix(defaultPath, "PATH="))
+	}
+	return exec.LookPath(file)
+}
+
+// setupRootfs mounts a tmpfs on spec.Root with read-only system directories, devices, proc, tmp
+// and the exec root of the action, then makes it the root of the sandbox.
+func setupRootfs(spec *sandboxSpec) error {
+	// mounts in the sandbox should not propagate to the host
+	if err := mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+	root := spec.Root
+	if err := mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return err
+	}
+	for _, dir := range sandboxReadonlyDirs {
+		if err := bindMount(dir, root, true); err != nil {
+			return err
+		}
+	}
+
+	dev := filepath.Join(root, "dev")
+	if err := mountTmpfs(dev, unix.MS_NOSUID|unix.MS_NOEXEC, "mode=0755"); err != nil {
+		return err
+	}
+	for _, device := range sandboxDevices {
+		if err := bindMount(device, root, false); err != nil {
+			return err
+		}
+	}
+	links := map[string]string{"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2"}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return err
+		}
+	}
+	if err := mountTmpfs(filepath.Join(dev, "shm"), unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return err
+	}
+
+	// proc of the new pid namespace only shows processes of the action
+	if err := os.Mkdir(filepath.Join(root, "proc"), 0755); err != nil {
+		return err
+	}
+	if err := mount("proc", filepath.Join(root, "proc"), "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return err
+	}
+	if err := mountTmpfs(filepath.Join(root, "tmp"), unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return err
+	}
+	if err := bindMount(spec.ExecRoot, root, false); err != nil {
+		return err
+	}
+
+	if err := unix.Chdir(root); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("fail to pivot root to %s: %s", root, err)
+	}
+	// the old root is stacked on the new one after pivot_root(".", ".")
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return err
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	return mount("", "/", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, "")
+}
+
+// mount is unix.Mount with the target in the error
+func mount(source, target, fstype string, flags uintptr, data string) error {
+	if err := unix.Mount(source, target, fstype, flags, data); err != nil {
+		return fmt.Errorf("fail to mount %s on %s: %s", source, target, err)
+	}
+	return nil
+}
+
+func mountTmpfs(target string, flags uintptr, data string) error {
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	return mount("tmpfs", target, "tmpfs", flags, data)
+}
+
+// bindMount mounts src of the host at the same path under root, symlinks are copied and missing src is skipped
+func bindMount(src, root string, readonly bool) error {
+	fi, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	target := filepath.Join(root, src)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case fi.IsDir():
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+	default:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	if err := mount(src, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return err
+	}
+	if !readonly {
+		return nil
+	}
+	// flags of the mount locked by the host should be kept, otherwise remount fails with EPERM
+	var fs unix.Statfs_t
+	if err := unix.Statfs(target, &fs); err != nil {
+		return err
+	}
+	return mount("", target, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|lockedMountFlags(fs.Flags), "")
+}
+
+// lockedMountFlags converts ST_* flags of statfs to MS_* flags which can not be cleared in user namespaces
+func lockedMountFlags(flags int64) uintptr {
+	var ms uintptr
+	for st, m := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if flags&st != 0 {
+			ms |= m
+		}
+	}
+	return ms
+}
+
+// setLoopbackUp brings lo of the new network namespace up, so the action can still listen on localhost
+func setLoopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+// dropCapabilities makes the command run without any capability even as root of the user namespace
+func dropCapabilities() error {
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return err
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return err
+	}
+	// PR_CAPBSET_DROP fails with EINVAL on capabilities unknown to the kernel
+	for c := 0; ; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err == unix.EINVAL {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	// inheritable capabilities raised for ambient ones are kept by root on execve regardless of the bounding set
+	var data [2]unix.CapUserData
+	return unix.Capset(&unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}, &data[0])
+}
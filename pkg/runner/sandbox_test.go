@@ -0,0 +1,103 @@
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dashjay/baize/pkg/config"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary is executed as the init process of sandboxes
+	SandboxInit()
+	os.Exit(m.Run())
+}
+
+func newTestSandbox(t *testing.T) *sandbox {
+	s, err := newSandbox(&config.SandboxConfig{Enabled: true})
+	if err != nil {
+		t.Skipf("sandbox is not available: %s", err)
+	}
+	return s
+}
+
+func TestSandbox(t *testing.T) {
+	s := newTestSandbox(t)
+	dir, err := ioutil.TempDir("", "sandbox-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	execRoot := filepath.Join(dir, "action")
+	assert.Nil(t, os.MkdirAll(filepath.Join(execRoot, "src"), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644))
+
+	run := func(network bool, script string) (int, string) {
+		command := &repb.Command{Arguments: []string{"sh", "-c", script}}
+		result := s.run(context.Background(), network, command, execRoot, filepath.Join(execRoot, "src"), nil, nil)
+		assert.Nil(t, result.Error)
+		return result.ExitCode, strings.TrimSpace(string(result.Stdout))
+	}
+
+	code, out := run(false, "echo output > out; pwd; echo $$; hostname")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, []string{filepath.Join(execRoot, "src"), "1", "localhost"}, strings.Split(out, "\n"))
+	data, err := ioutil.ReadFile(filepath.Join(execRoot, "src", "out"))
+	assert.Nil(t, err)
+	assert.Equal(t, "output\n", string(data))
+
+	// files out of the exec root are invisible and system directories are read-only
+	code, _ = run(false, "cat "+filepath.Join(dir, "secret"))
+	assert.NotEqual(t, 0, code)
+	code, _ = run(false, "touch /etc/sandbox-test")
+	assert.NotEqual(t, 0, code)
+	_, err = os.Stat("/etc/sandbox-test")
+	assert.True(t, os.IsNotExist(err))
+
+	// only loopback is in the network namespace
+	_, out = run(false, "tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '")
+	assert.Equal(t, "lo", out)
+	code, _ = run(true, "true")
+	assert.Equal(t, 0, code)
+
+	// the action has no capability even if the executor runs as root
+	_, out = run(false, "grep CapEff /proc/self/status")
+	assert.Equal(t, "CapEff:\t0000000000000000", out)
+
+	result := s.run(context.Background(), false, &repb.Command{Arguments: []string{"no-such-command"}}, execRoot, execRoot, nil, nil)
+	assert.True(t, status.IsNotFoundError(result.Error))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result = s.run(ctx, false, &repb.Command{Arguments: []string{"sleep", "10"}}, execRoot, execRoot, nil, nil)
+	assert.True(t, status.IsDeadlineExceededError(result.Error))
+}
+
+func TestCgroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup-test-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := &sandbox{cgroupDir: dir, cpus: 1.5, memoryBytes: 1 << 30}
+	assert.Equal(t, []string{"cpu", "memory"}, s.controllers())
+	assert.NotNil(t, s.enableControllers())
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("cpuset cpu io memory pids\n"), 0644))
+	assert.Nil(t, s.enableControllers())
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	assert.Equal(t, "+cpu +memory", string(data))
+
+	c, err := s.newCgroup()
+	assert.Nil(t, err)
+	data, _ = ioutil.ReadFile(filepath.Join(c.dir, "cpu.max"))
+	assert.Equal(t, "150000 100000", string(data))
+	data, _ = ioutil.ReadFile(filepath.Join(c.dir, "memory.max"))
+	assert.Equal(t, "1073741824", string(data))
+	assert.False(t, c.oomKilled())
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(c.dir, "memory.events"), []byte("low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n"), 0644))
+	assert.True(t, c.oomKilled())
+}
@@ -1,12 +1,168 @@
 package scheduler
 
 import (
+	"context"
+	"io"
+	"sort"
 	"sync"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/sirupsen/logrus"
+	nstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+
+	"github.com/dashjay/baize/pkg/admission"
+	"github.com/dashjay/baize/pkg/config"
+	schedulerpb "github.com/dashjay/baize/pkg/proto/scheduler"
+	"github.com/dashjay/baize/pkg/utils/platform"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+const (
+	// defaultHeartBeatTimeout is how long an executor is considered alive after its last heartbeat
+	defaultHeartBeatTimeout = 30 * time.Second
+
+	// defaultGetJobTimeout is how long GetJob waits for a job before returning an empty response
+	defaultGetJobTimeout = 10 * time.Second
+
+	// defaultMaxJobRetries is how many times a job failed by its executor is run again
+	defaultMaxJobRetries = 2
 )
 
+// Job is an action waiting to be executed by one of the executors
+type Job struct {
+	ID           string
+	InstanceName string
+	ActionDigest *repb.Digest
+	Action       *repb.Action
+	// Platform required by the action, the job is only assigned to executors satisfying it
+	Platform *repb.Platform
+	// Priority of the job, lower value means higher priority
+	Priority int32
+	// OnFetch is called when the job is fetched by an executor
+	OnFetch func()
+	// OnLog is called with outputs of the command forwarded by the executor running the job
+	OnLog func(stderr bool, data []byte)
+
+	// request is resources requested by the platform, it should fit in the capacity of the executor
+	request admission.Request
+	// executorID is the executor which fetched the job, empty if not fetched yet
+	executorID string
+	// failedExecutors are executors the job failed on, the job is retried on other executors if possible
+	failedExecutors []string
+	result          *JobResult
+	done            chan struct{}
+}
+
+// JobResult is reported by executor when the job finished or failed
+type JobResult struct {
+	// ActionResultDigest is the digest of ActionResult uploaded to CAS, only set when Status is OK
+	ActionResultDigest *repb.Digest
+	ExecutionMetadata  *repb.ExecutedActionMetadata
+	Status             *nstatus.Status
+}
+
+// Wait blocks until the job finished or failed, the job must be enqueued first
+func (j *Job) Wait(ctx context.Context) (*JobResult, error) {
+	select {
+	case <-j.done:
+		return j.result, nil
+	case <-ctx.Done():
+		return nil, status.CanceledErrorf("wait job %s canceled: %s", j.ID, ctx.Err())
+	}
+}
+
+func (j *Job) failedOn(executorID string) bool {
+	for _, id := range j.failedExecutors {
+		if id == executorID {
+			return true
+		}
+	}
+	return false
+}
+
+// insertJob inserts job into jobs ordered by priority, jobs with the same priority are kept in FIFO order
+func insertJob(jobs []*Job, job *Job) []*Job {
+	idx := sort.Search(len(jobs), func(i int) bool {
+		return jobs[i].Priority > job.Priority
+	})
+	jobs = append(jobs, nil)
+	copy(jobs[idx+1:], jobs[idx:])
+	jobs[idx] = job
+	return jobs
+}
+
+// removeJob removes the job with id from jobs
+func removeJob(jobs []*Job, id string) ([]*Job, bool) {
+	for i := range jobs {
+		if jobs[i].ID == id {
+			return append(jobs[:i], jobs[i+1:]...), true
+		}
+	}
+	return jobs, false
+}
+
+// Client is an executor registered to scheduler by HeartBeat
 type Client struct {
 	sync.Mutex
+	// counter is the number of jobs assigned to this client and not finished yet
 	counter int
+
+	id            string
+	property      *schedulerpb.Property
+	lastHeartBeat time.Time
+	jobs          []*Job
+	// canceled holds ids of jobs running on this client which have been canceled,
+	// they are delivered to the client on its next heartbeat.
+	canceled []string
+	// ready is notified when a job is assigned to this client
+	ready chan struct{}
+}
+
+func newClient(id string) *Client {
+	return &Client{id: id, ready: make(chan struct{}, 1)}
+}
+
+func (c *Client) assign(job *Job) {
+	c.Lock()
+	c.jobs = insertJob(c.jobs, job)
+	c.counter++
+	c.Unlock()
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) pop() *Job {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.jobs) == 0 {
+		return nil
+	}
+	job := c.jobs[0]
+	c.jobs = c.jobs[1:]
+	return job
+}
+
+// remove removes a job not fetched by this client
+func (c *Client) remove(id string) bool {
+	c.Lock()
+	defer c.Unlock()
+	var removed bool
+	c.jobs, removed = removeJob(c.jobs, id)
+	return removed
+}
+
+// drain removes all jobs not fetched by this client
+func (c *Client) drain() []*Job {
+	c.Lock()
+	defer c.Unlock()
+	jobs := c.jobs
+	c.jobs = nil
+	c.counter = 0
+	return jobs
 }
 
 type ClientSets []*Client
@@ -20,6 +176,395 @@ func (cs ClientSets) Swap(i, j int) {
 	cs[i], cs[j] = cs[j], cs[i]
 }
 
-type Information struct {
-	CPU int
+// Scheduler implements schedulerpb.SchedulerServer.
+// Executors register themselves by HeartBeat and pull jobs by GetJob,
+// jobs scheduled are dispatched to the least loaded live executor satisfying their platform.
+type Scheduler struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+	// pending holds jobs scheduled while no executor satisfying them is alive
+	pending []*Job
+	// jobs holds all jobs not finished yet, indexed by job id
+	jobs map[string]*Job
+
+	heartBeatTimeout time.Duration
+	getJobTimeout    time.Duration
+	maxJobRetries    int
+
+	// stop is closed by Stop to end expiring executors
+	stop     chan struct{}
+	stopOnce sync.Once
 }
+
+func NewScheduler(cfg *config.ServerConfig) *Scheduler {
+	s := &Scheduler{
+		clients:          make(map[string]*Client),
+		jobs:             make(map[string]*Job),
+		heartBeatTimeout: defaultHeartBeatTimeout,
+		getJobTimeout:    defaultGetJobTimeout,
+		maxJobRetries:    defaultMaxJobRetries,
+		stop:             make(chan struct{}),
+	}
+	if cfg.HeartBeatTimeout > 0 {
+		s.heartBeatTimeout = time.Duration(cfg.HeartBeatTimeout) * time.Second
+	}
+	if cfg.MaxJobRetries > 0 {
+		s.maxJobRetries = cfg.MaxJobRetries
+	} else if cfg.MaxJobRetries < 0 {
+		s.maxJobRetries = 0
+	}
+	go func() {
+		t := time.NewTicker(s.heartBeatTimeout / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-t.C:
+				s.expire(now)
+			}
+		}
+	}()
+	return s
+}
+
+// Stop stops expiring executors, it is safe to call more than once
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// EnqueueJob put a job into the queue of the least loaded executor satisfying its platform,
+// the job will be pending if there is no executor alive, and rejected with FAILED_PRECONDITION
+// if none of executors alive satisfies it or has enough CPU slots and memory for it.
+func (s *Scheduler) EnqueueJob(job *Job) error {
+	// memory of executors is unknown here, so only memory requested explicitly is checked
+	request, err := admission.NewRequest(job.Platform, 0)
+	if err != nil {
+		return err
+	}
+	job.request = request
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.ID]; exists {
+		return status.AlreadyExistsErrorf("job %s already scheduled", job.ID)
+	}
+	if len(s.clients) > 0 && len(s.candidatesLocked(job)) == 0 {
+		return status.FailedPreconditionErrorf("no executor satisfies platform [%s] of job %s", platform.String(job.Platform), job.ID)
+	}
+	job.done = make(chan struct{})
+	s.jobs[job.ID] = job
+	s.dispatchLocked(job)
+	return nil
+}
+
+// candidatesLocked returns executors alive satisfying the platform of job
+// with enough CPU slots and memory for it
+func (s *Scheduler) candidatesLocked(job *Job) ClientSets {
+	cs := make(ClientSets, 0, len(s.clients))
+	for _, c := range s.clients {
+		if err := platform.Satisfies(c.property.GetPlatform(), job.Platform); err != nil {
+			logrus.Tracef("executor %s can not run job %s: %s", c.id, job.ID, err)
+			continue
+		}
+		if !fitsCapacity(c.property, job.request) {
+			logrus.Tracef("executor %s has not enough resources for job %s", c.id, job.ID)
+			continue
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// fitsCapacity reports whether r fits in CPU slots and memory of an executor, zero means unknown
+func fitsCapacity(p *schedulerpb.Property, r admission.Request) bool {
+	if p.GetCpu() > 0 && r.CPUs > int64(p.GetCpu()) {
+		return false
+	}
+	return p.GetMemory() <= 0 || r.MemoryBytes <= p.GetMemory()
+}
+
+func (s *Scheduler) dispatchLocked(job *Job) {
+	cs := s.candidatesLocked(job)
+	if len(cs) == 0 {
+		s.pending = insertJob(s.pending, job)
+		logrus.Debugf("no executor alive satisfies job %s, pending", job.ID)
+		return
+	}
+	sort.Sort(cs)
+	c := cs[0]
+	for _, candidate := range cs {
+		if !job.failedOn(candidate.id) {
+			c = candidate
+			break
+		}
+	}
+	c.assign(job)
+	logrus.Debugf("job %s dispatched to executor %s", job.ID, c.id)
+}
+
+// retryable reports whether a job failed with code by its executor rather than by the action
+func retryable(code codes.Code) bool {
+	return code == codes.Unavailable || code == codes.Aborted || code == codes.DataLoss
+}
+
+// retryLocked dispatches a job failed by its executor again, preferably to another executor.
+// It returns false if the job should fail with st.
+func (s *Scheduler) retryLocked(job *Job, st *nstatus.Status) bool {
+	if !retryable(codes.Code(st.GetCode())) || len(job.failedExecutors) >= s.maxJobRetries {
+		return false
+	}
+	if c, exists := s.clients[job.executorID]; exists && c.counter > 0 {
+		c.counter--
+	}
+	logrus.Warnf("job %s failed on executor %s: %s, retry %d/%d", job.ID, job.executorID, st.GetMessage(), len(job.failedExecutors)+1, s.maxJobRetries)
+	job.failedExecutors = append(job.failedExecutors, job.executorID)
+	job.executorID = ""
+	s.dispatchLocked(job)
+	return true
+}
+
+// completeLocked records the result of a job and wakes up all waiters
+func (s *Scheduler) completeLocked(job *Job, result *JobResult) {
+	if c, exists := s.clients[job.executorID]; exists && c.counter > 0 {
+		c.counter--
+	}
+	delete(s.jobs, job.ID)
+	job.result = result
+	close(job.done)
+}
+
+// CancelJob cancels a job, the job is removed from queue if not fetched yet,
+// otherwise the executor running it will be told on its next heartbeat.
+func (s *Scheduler) CancelJob(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, exists := s.jobs[id]
+	if !exists {
+		return
+	}
+	if job.executorID != "" {
+		if c, alive := s.clients[job.executorID]; alive {
+			c.canceled = append(c.canceled, id)
+		}
+	} else {
+		var removed bool
+		if s.pending, removed = removeJob(s.pending, id); !removed {
+			for _, c := range s.clients {
+				if c.remove(id) {
+					c.counter--
+					break
+				}
+			}
+		}
+	}
+	s.completeLocked(job, &JobResult{Status: &nstatus.Status{Code: int32(codes.Canceled), Message: "job " + id + " canceled"}})
+	logrus.Infof("job %s canceled", id)
+}
+
+// expire removes executors whose last heartbeat is older than heartBeatTimeout,
+// jobs not fetched are dispatched to other executors and jobs running on them are retried or failed.
+func (s *Scheduler) expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var orphans []*Job
+	for id, c := range s.clients {
+		if now.Sub(c.lastHeartBeat) > s.heartBeatTimeout {
+			logrus.Warnf("executor %s lost heartbeat since %s, removed", id, c.lastHeartBeat)
+			delete(s.clients, id)
+			orphans = append(orphans, c.drain()...)
+		}
+	}
+	for _, job := range s.jobs {
+		if job.executorID == "" {
+			continue
+		}
+		if _, alive := s.clients[job.executorID]; !alive {
+			st := &nstatus.Status{
+				Code:    int32(codes.Unavailable),
+				Message: "executor " + job.executorID + " lost while running the job",
+			}
+			if !s.retryLocked(job, st) {
+				s.completeLocked(job, &JobResult{Status: st})
+			}
+		}
+	}
+	for _, job := range orphans {
+		s.dispatchLocked(job)
+	}
+}
+
+func (s *Scheduler) getClient(id string) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clients[id]
+}
+
+// popJob takes the next job of client and marks it running on the client,
+// counters of clients are only changed with s.mu held so that dispatchLocked can compare them.
+func (s *Scheduler) popJob(c *Client) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := c.pop()
+	if job != nil {
+		job.executorID = c.id
+		if job.OnFetch != nil {
+			job.OnFetch()
+		}
+	}
+	return job
+}
+
+// runningJobLocked returns the job fetched by executor
+func (s *Scheduler) runningJobLocked(executorID, jobID string) (*Job, error) {
+	job, exists := s.jobs[jobID]
+	if !exists {
+		return nil, status.NotFoundErrorf("job %s not found", jobID)
+	}
+	if job.executorID != executorID {
+		return nil, status.FailedPreconditionErrorf("job %s is not running on executor %s", jobID, executorID)
+	}
+	return job, nil
+}
+
+func (s *Scheduler) HeartBeat(ctx context.Context, in *schedulerpb.HeartBeatReq) (*schedulerpb.HeartBeatResp, error) {
+	if in.GetExecutorId() == "" {
+		return nil, status.InvalidArgumentError("executor_id is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, exists := s.clients[in.GetExecutorId()]
+	if !exists {
+		logrus.Infof("executor %s registered with %s", in.GetExecutorId(), in.GetExecutorInfo())
+		c = newClient(in.GetExecutorId())
+		s.clients[in.GetExecutorId()] = c
+	}
+	c.property = in.GetExecutorInfo()
+	c.lastHeartBeat = time.Now()
+	if !exists && len(s.pending) > 0 {
+		pending := s.pending
+		s.pending = nil
+		for _, job := range pending {
+			s.dispatchLocked(job)
+		}
+	}
+	canceled := c.canceled
+	c.canceled = nil
+	return &schedulerpb.HeartBeatResp{Status: &nstatus.Status{Code: int32(codes.OK)}, CanceledJobIds: canceled}, nil
+}
+
+// GetJob returns a job assigned to the executor, if there is no job it waits for getJobTimeout
+// and returns an empty response.
+func (s *Scheduler) GetJob(ctx context.Context, in *schedulerpb.GetJobReq) (*schedulerpb.GetJobResp, error) {
+	c := s.getClient(in.GetExecutorId())
+	if c == nil {
+		return nil, status.FailedPreconditionErrorf("executor %s is not registered, heartbeat first", in.GetExecutorId())
+	}
+	timer := time.NewTimer(s.getJobTimeout)
+	defer timer.Stop()
+	for {
+		if job := s.popJob(c); job != nil {
+			logrus.Debugf("job %s fetched by executor %s", job.ID, c.id)
+			return &schedulerpb.GetJobResp{
+				Job:          job.Action,
+				JobId:        job.ID,
+				ActionDigest: job.ActionDigest,
+				InstanceName: job.InstanceName,
+				Platform:     job.Platform,
+			}, nil
+		}
+		select {
+		case <-c.ready:
+		case <-timer.C:
+			return &schedulerpb.GetJobResp{}, nil
+		case <-ctx.Done():
+			return nil, status.CanceledErrorf("get job canceled: %s", ctx.Err())
+		}
+	}
+}
+
+// FinishJob is called by executor when the ActionResult of the job was uploaded
+func (s *Scheduler) FinishJob(ctx context.Context, in *schedulerpb.FinishJobReq) (*schedulerpb.FinishJobResp, error) {
+	if in.GetActionResultDigest() == nil {
+		return nil, status.InvalidArgumentError("action_result_digest is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, err := s.runningJobLocked(in.GetExecutorId(), in.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	s.completeLocked(job, &JobResult{
+		ActionResultDigest: in.GetActionResultDigest(),
+		ExecutionMetadata:  in.GetExecutionMetadata(),
+		Status:             &nstatus.Status{Code: int32(codes.OK)},
+	})
+	logrus.Debugf("job %s finished by executor %s", job.ID, in.GetExecutorId())
+	return &schedulerpb.FinishJobResp{Status: &nstatus.Status{Code: int32(codes.OK)}}, nil
+}
+
+// FailJob is called by executor when the job can not be finished, jobs failed for the executor
+// rather than the action are run again on another executor up to maxJobRetries times.
+func (s *Scheduler) FailJob(ctx context.Context, in *schedulerpb.FailJobReq) (*schedulerpb.FailJobResp, error) {
+	if in.GetStatus().GetCode() == int32(codes.OK) {
+		return nil, status.InvalidArgumentError("status of failed job should not be OK")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, err := s.runningJobLocked(in.GetExecutorId(), in.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	if s.retryLocked(job, in.GetStatus()) {
+		return &schedulerpb.FailJobResp{Status: &nstatus.Status{Code: int32(codes.OK)}}, nil
+	}
+	s.completeLocked(job, &JobResult{Status: in.GetStatus(), ActionResultDigest: in.GetActionResultDigest()})
+	logrus.Warnf("job %s failed on executor %s: %s", job.ID, in.GetExecutorId(), in.GetStatus().GetMessage())
+	return &schedulerpb.FailJobResp{Status: &nstatus.Status{Code: int32(codes.OK)}}, nil
+}
+
+// ScheduleJob is called by frontend to put a job into the queue
+func (s *Scheduler) ScheduleJob(ctx context.Context, in *schedulerpb.ScheduleJobReq) (*schedulerpb.ScheduleJobResp, error) {
+	if in.GetJobId() == "" || in.GetAction() == nil || in.GetActionDigest() == nil {
+		return nil, status.InvalidArgumentError("job_id, action and action_digest are required")
+	}
+	err := s.EnqueueJob(&Job{
+		ID:           in.GetJobId(),
+		InstanceName: in.GetInstanceName(),
+		ActionDigest: in.GetActionDigest(),
+		Action:       in.GetAction(),
+		Platform:     in.GetPlatform(),
+		Priority:     in.GetPriority(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &schedulerpb.ScheduleJobResp{Status: &nstatus.Status{Code: int32(codes.OK)}}, nil
+}
+
+// WriteJobLog passes outputs of running jobs to OnLog of them, outputs of jobs
+// no longer running on the executor are dropped.
+func (s *Scheduler) WriteJobLog(stream schedulerpb.Scheduler_WriteJobLogServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&schedulerpb.WriteJobLogResp{Status: &nstatus.Status{Code: int32(codes.OK)}})
+		}
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		job, err := s.runningJobLocked(in.GetExecutorId(), in.GetJobId())
+		s.mu.Unlock()
+		if err != nil {
+			logrus.Tracef("drop log of job %s: %s", in.GetJobId(), err)
+			continue
+		}
+		if job.OnLog != nil {
+			job.OnLog(in.GetStderr(), in.GetData())
+		}
+	}
+}
+
+var _ schedulerpb.SchedulerServer = (*Scheduler)(nil)
@@ -0,0 +1,358 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"time"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	nstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/dashjay/baize/pkg/config"
+	schedulerpb "github.com/dashjay/baize/pkg/proto/scheduler"
+	"github.com/dashjay/baize/pkg/utils"
+	"github.com/dashjay/baize/pkg/utils/platform"
+	"github.com/dashjay/baize/pkg/utils/status"
+)
+
+type fakeWriteJobLogServer struct {
+	grpc.ServerStream
+	reqs []*schedulerpb.WriteJobLogReq
+	resp *schedulerpb.WriteJobLogResp
+}
+
+func (f *fakeWriteJobLogServer) Recv() (*schedulerpb.WriteJobLogReq, error) {
+	if len(f.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := f.reqs[0]
+	f.reqs = f.reqs[1:]
+	return req, nil
+}
+
+func (f *fakeWriteJobLogServer) SendAndClose(resp *schedulerpb.WriteJobLogResp) error {
+	f.resp = resp
+	return nil
+}
+
+func newTestJob(id string) *Job {
+	return &Job{
+		ID:           id,
+		ActionDigest: utils.CalSHA256OfInput([]byte(id)),
+		Action:       &repb.Action{},
+	}
+}
+
+var _ = Describe("test scheduler", func() {
+	var (
+		ctx = context.Background()
+		s   *Scheduler
+	)
+	heartBeat := func(id string) {
+		_, err := s.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: id, ExecutorInfo: &schedulerpb.Property{Cpu: 1}})
+		Expect(err).To(BeNil())
+	}
+	getJob := func(id string) *schedulerpb.GetJobResp {
+		resp, err := s.GetJob(ctx, &schedulerpb.GetJobReq{ExecutorId: id})
+		Expect(err).To(BeNil())
+		return resp
+	}
+	// queuedOn returns the executor a job is queued on
+	queuedOn := func(jobID string) string {
+		for id, c := range s.clients {
+			for _, job := range c.jobs {
+				if job.ID == jobID {
+					return id
+				}
+			}
+		}
+		return ""
+	}
+	BeforeEach(func() {
+		s = NewScheduler(&config.ServerConfig{})
+		s.getJobTimeout = 50 * time.Millisecond
+	})
+	AfterEach(func() {
+		s.Stop()
+	})
+	It("stop expiring executors once stopped", func() {
+		s.Stop()
+		s = NewScheduler(&config.ServerConfig{HeartBeatTimeout: 1})
+		heartBeat("a")
+		Eventually(func() *Client { return s.getClient("a") }, 3*time.Second).Should(BeNil())
+		heartBeat("a")
+		s.Stop()
+		s.Stop()
+		Consistently(func() *Client { return s.getClient("a") }, 1500*time.Millisecond).ShouldNot(BeNil())
+	})
+	It("reject unknown executor", func() {
+		_, err := s.GetJob(ctx, &schedulerpb.GetJobReq{ExecutorId: "unknown"})
+		Expect(err).NotTo(BeNil())
+	})
+	It("return empty job when nothing queued", func() {
+		heartBeat("a")
+		Expect(getJob("a").GetJobId()).To(Equal(""))
+	})
+	It("dispatch pending jobs once executor registered", func() {
+		Expect(s.EnqueueJob(newTestJob("job-1"))).To(BeNil())
+		heartBeat("a")
+		resp := getJob("a")
+		Expect(resp.GetJobId()).To(Equal("job-1"))
+		Expect(resp.GetActionDigest()).NotTo(BeNil())
+	})
+	It("dispatch jobs to the least loaded executor", func() {
+		heartBeat("a")
+		heartBeat("b")
+		Expect(s.EnqueueJob(newTestJob("job-1"))).To(BeNil())
+		Expect(s.EnqueueJob(newTestJob("job-2"))).To(BeNil())
+		Expect(s.clients["a"].counter).To(Equal(1))
+		Expect(s.clients["b"].counter).To(Equal(1))
+	})
+	It("wake up waiting GetJob", func() {
+		heartBeat("a")
+		s.getJobTimeout = time.Second
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(10 * time.Millisecond)
+			Expect(s.EnqueueJob(newTestJob("job-1"))).To(BeNil())
+		}()
+		Expect(getJob("a").GetJobId()).To(Equal("job-1"))
+	})
+	It("redispatch jobs of expired executor", func() {
+		heartBeat("a")
+		Expect(s.EnqueueJob(newTestJob("job-1"))).To(BeNil())
+		s.clients["a"].lastHeartBeat = time.Now().Add(-2 * s.heartBeatTimeout)
+		heartBeat("b")
+		s.expire(time.Now())
+		Expect(s.getClient("a")).To(BeNil())
+		Expect(getJob("b").GetJobId()).To(Equal("job-1"))
+	})
+	It("fetch jobs by priority", func() {
+		heartBeat("a")
+		low := newTestJob("job-low")
+		low.Priority = 10
+		high := newTestJob("job-high")
+		high.Priority = -10
+		Expect(s.EnqueueJob(low)).To(BeNil())
+		Expect(s.EnqueueJob(newTestJob("job-default"))).To(BeNil())
+		Expect(s.EnqueueJob(high)).To(BeNil())
+		Expect(getJob("a").GetJobId()).To(Equal("job-high"))
+		Expect(getJob("a").GetJobId()).To(Equal("job-default"))
+		Expect(getJob("a").GetJobId()).To(Equal("job-low"))
+	})
+	It("reject duplicated job", func() {
+		Expect(s.EnqueueJob(newTestJob("job-1"))).To(BeNil())
+		Expect(s.EnqueueJob(newTestJob("job-1"))).NotTo(BeNil())
+	})
+	It("finish job and wake up waiter", func() {
+		heartBeat("a")
+		job := newTestJob("job-1")
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		Expect(getJob("a").GetJobId()).To(Equal("job-1"))
+		resultDigest := utils.CalSHA256OfInput([]byte("result"))
+		_, err := s.FinishJob(ctx, &schedulerpb.FinishJobReq{ExecutorId: "b", JobId: "job-1", ActionResultDigest: resultDigest})
+		Expect(err).NotTo(BeNil())
+		_, err = s.FinishJob(ctx, &schedulerpb.FinishJobReq{ExecutorId: "a", JobId: "job-1", ActionResultDigest: resultDigest})
+		Expect(err).To(BeNil())
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.OK)))
+		Expect(result.ActionResultDigest).To(Equal(resultDigest))
+		Expect(s.clients["a"].counter).To(Equal(0))
+	})
+	It("fail job", func() {
+		heartBeat("a")
+		job := newTestJob("job-1")
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		Expect(getJob("a").GetJobId()).To(Equal("job-1"))
+		_, err := s.FailJob(ctx, &schedulerpb.FailJobReq{ExecutorId: "a", JobId: "job-1", Status: &nstatus.Status{Code: int32(codes.Internal)}})
+		Expect(err).To(BeNil())
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.Internal)))
+	})
+	It("fail running jobs of expired executor", func() {
+		s.maxJobRetries = 0
+		heartBeat("a")
+		job := newTestJob("job-1")
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		Expect(getJob("a").GetJobId()).To(Equal("job-1"))
+		s.clients["a"].lastHeartBeat = time.Now().Add(-2 * s.heartBeatTimeout)
+		s.expire(time.Now())
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.Unavailable)))
+	})
+	It("retry jobs failed by executors on other executors", func() {
+		heartBeat("a")
+		heartBeat("b")
+		job := newTestJob("job-1")
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		first := queuedOn("job-1")
+		Expect(getJob(first).GetJobId()).To(Equal("job-1"))
+		unavailable := &nstatus.Status{Code: int32(codes.Unavailable), Message: "disk error"}
+		_, err := s.FailJob(ctx, &schedulerpb.FailJobReq{ExecutorId: first, JobId: "job-1", Status: unavailable})
+		Expect(err).To(BeNil())
+
+		second := "a"
+		if first == "a" {
+			second = "b"
+		}
+		Expect(s.clients[first].counter).To(Equal(0))
+		Expect(getJob(second).GetJobId()).To(Equal("job-1"))
+		// the executor is lost, the job goes back to the first executor as no other one is left
+		s.clients[second].lastHeartBeat = time.Now().Add(-2 * s.heartBeatTimeout)
+		s.expire(time.Now())
+		Expect(getJob(first).GetJobId()).To(Equal("job-1"))
+
+		_, err = s.FailJob(ctx, &schedulerpb.FailJobReq{ExecutorId: first, JobId: "job-1", Status: unavailable})
+		Expect(err).To(BeNil())
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(result.Status.GetMessage()).To(Equal("disk error"))
+	})
+	It("not retry jobs failed by actions", func() {
+		heartBeat("a")
+		heartBeat("b")
+		job := newTestJob("job-1")
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		executorID := queuedOn("job-1")
+		Expect(getJob(executorID).GetJobId()).To(Equal("job-1"))
+		_, err := s.FailJob(ctx, &schedulerpb.FailJobReq{ExecutorId: executorID, JobId: "job-1", Status: &nstatus.Status{Code: int32(codes.FailedPrecondition)}})
+		Expect(err).To(BeNil())
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.FailedPrecondition)))
+	})
+	It("cancel queued job", func() {
+		heartBeat("a")
+		job := newTestJob("job-1")
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		s.CancelJob("job-1")
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.Canceled)))
+		Expect(s.clients["a"].counter).To(Equal(0))
+		Expect(getJob("a").GetJobId()).To(Equal(""))
+	})
+	It("tell executor canceled running job by heartbeat", func() {
+		heartBeat("a")
+		job := newTestJob("job-1")
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		Expect(getJob("a").GetJobId()).To(Equal("job-1"))
+		s.CancelJob("job-1")
+		result, err := job.Wait(ctx)
+		Expect(err).To(BeNil())
+		Expect(result.Status.GetCode()).To(Equal(int32(codes.Canceled)))
+		resp, err := s.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: "a", ExecutorInfo: &schedulerpb.Property{Cpu: 1}})
+		Expect(err).To(BeNil())
+		Expect(resp.GetCanceledJobIds()).To(Equal([]string{"job-1"}))
+		resp, err = s.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: "a", ExecutorInfo: &schedulerpb.Property{Cpu: 1}})
+		Expect(err).To(BeNil())
+		Expect(resp.GetCanceledJobIds()).To(BeEmpty())
+	})
+	It("schedule job by rpc", func() {
+		heartBeat("a")
+		_, err := s.ScheduleJob(ctx, &schedulerpb.ScheduleJobReq{JobId: "job-1"})
+		Expect(err).NotTo(BeNil())
+		_, err = s.ScheduleJob(ctx, &schedulerpb.ScheduleJobReq{
+			JobId:        "job-1",
+			ActionDigest: utils.CalSHA256OfInput([]byte("job-1")),
+			Action:       &repb.Action{},
+			Priority:     1,
+		})
+		Expect(err).To(BeNil())
+		Expect(getJob("a").GetJobId()).To(Equal("job-1"))
+	})
+	It("dispatch jobs to executors satisfying their platform", func() {
+		arm := &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.ISA, Value: "aarch64"}}}
+		x86 := &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.ISA, Value: "x86-64"}}}
+		_, err := s.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: "arm", ExecutorInfo: &schedulerpb.Property{Platform: arm}})
+		Expect(err).To(BeNil())
+		_, err = s.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: "x86", ExecutorInfo: &schedulerpb.Property{Platform: x86}})
+		Expect(err).To(BeNil())
+		for _, id := range []string{"job-1", "job-2"} {
+			job := newTestJob(id)
+			job.Platform = arm
+			Expect(s.EnqueueJob(job)).To(BeNil())
+		}
+		Expect(s.clients["arm"].counter).To(Equal(2))
+		Expect(s.clients["x86"].counter).To(Equal(0))
+
+		job := newTestJob("job-3")
+		job.Platform = &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.ISA, Value: "riscv64"}}}
+		err = s.EnqueueJob(job)
+		Expect(status.IsFailedPreconditionError(err)).To(BeTrue())
+	})
+	It("dispatch jobs to executors with enough resources", func() {
+		_, err := s.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: "small", ExecutorInfo: &schedulerpb.Property{Cpu: 2, Memory: 1 << 30}})
+		Expect(err).To(BeNil())
+		_, err = s.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: "large", ExecutorInfo: &schedulerpb.Property{Cpu: 16, Memory: 32 << 30}})
+		Expect(err).To(BeNil())
+		for _, id := range []string{"job-1", "job-2"} {
+			job := newTestJob(id)
+			job.Platform = &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.CPU, Value: "4"}}}
+			Expect(s.EnqueueJob(job)).To(BeNil())
+		}
+		job := newTestJob("job-3")
+		job.Platform = &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.Memory, Value: "2G"}}}
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		Expect(s.clients["small"].counter).To(Equal(0))
+		Expect(s.clients["large"].counter).To(Equal(3))
+		Expect(getJob("large").GetPlatform().GetProperties()[0].GetName()).To(Equal(platform.CPU))
+
+		job = newTestJob("job-4")
+		job.Platform = &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.CPU, Value: "32"}}}
+		Expect(status.IsFailedPreconditionError(s.EnqueueJob(job))).To(BeTrue())
+		job = newTestJob("job-5")
+		job.Platform = &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.Memory, Value: "a lot"}}}
+		Expect(status.IsInvalidArgumentError(s.EnqueueJob(job))).To(BeTrue())
+	})
+	It("pass logs of running jobs to OnLog", func() {
+		heartBeat("a")
+		heartBeat("b")
+		job := newTestJob("job-1")
+		var stdout, stderr string
+		job.OnLog = func(isStderr bool, data []byte) {
+			if isStderr {
+				stderr += string(data)
+			} else {
+				stdout += string(data)
+			}
+		}
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		runOn := queuedOn("job-1")
+		Expect(getJob(runOn).GetJobId()).To(Equal("job-1"))
+		other := "a"
+		if runOn == "a" {
+			other = "b"
+		}
+		server := &fakeWriteJobLogServer{reqs: []*schedulerpb.WriteJobLogReq{
+			{ExecutorId: runOn, JobId: "job-1", Data: []byte("hello")},
+			{ExecutorId: runOn, JobId: "job-1", Stderr: true, Data: []byte("oops")},
+			{ExecutorId: other, JobId: "job-1", Data: []byte("not running here")},
+			{ExecutorId: runOn, JobId: "unknown", Data: []byte("not a job")},
+			{ExecutorId: runOn, JobId: "job-1", Data: []byte(" world")},
+		}}
+		Expect(s.WriteJobLog(server)).To(BeNil())
+		Expect(server.resp.GetStatus().GetCode()).To(Equal(int32(codes.OK)))
+		Expect(stdout).To(Equal("hello world"))
+		Expect(stderr).To(Equal("oops"))
+	})
+	It("keep job pending until executor satisfying it registered", func() {
+		job := newTestJob("job-1")
+		job.Platform = &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.Pool, Value: "gpu"}}}
+		Expect(s.EnqueueJob(job)).To(BeNil())
+		heartBeat("a")
+		Expect(getJob("a").GetJobId()).To(Equal(""))
+		_, err := s.HeartBeat(ctx, &schedulerpb.HeartBeatReq{ExecutorId: "gpu", ExecutorInfo: &schedulerpb.Property{
+			Platform: &repb.Platform{Properties: []*repb.Platform_Property{{Name: platform.Pool, Value: "gpu"}}},
+		}})
+		Expect(err).To(BeNil())
+		Expect(getJob("gpu").GetJobId()).To(Equal("job-1"))
+	})
+})
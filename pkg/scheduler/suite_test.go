@@ -0,0 +1,16 @@
+package scheduler
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestScheduler(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "scheduler suite test")
+}
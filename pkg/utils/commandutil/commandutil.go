@@ -12,9 +12,11 @@ import (
 	"time"
 
 	"github.com/dashjay/baize/pkg/interfaces"
+	usagepb "github.com/dashjay/baize/pkg/proto/usage"
 	"github.com/dashjay/baize/pkg/utils/status"
 
 	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
@@ -31,9 +33,10 @@ var (
 	DebugStreamCommandOutputs = true
 )
 
-func constructExecCommand(ctx context.Context, command *repb.Command, workDir string, in io.Reader, out io.Writer) (*exec.Cmd, *bytes.Buffer, *bytes.Buffer) {
+// ConstructExecCommand returns the exec.Cmd of command and buffers holding its stdout and stderr
+func ConstructExecCommand(ctx context.Context, command *repb.Command, workDir string, in io.Reader, out, errOut io.Writer) (*exec.Cmd, *bytes.Buffer, *bytes.Buffer) {
 	executable, args := splitExecutableArgs(command.GetArguments())
-	cmd := exec.CommandContext(ctx, executable, args...)
+	cmd := exec.Command(executable, args...)
 	if workDir != "" {
 		cmd.Dir = workDir
 	}
@@ -43,6 +46,9 @@ func constructExecCommand(ctx context.Context, command *repb.Command, workDir st
 		cmd.Stdout = io.MultiWriter(cmd.Stdout, out)
 	}
 	cmd.Stderr = &stderr
+	if errOut != nil {
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, errOut)
+	}
 	if in != nil {
 		cmd.Stdin = in
 	}
@@ -72,15 +78,42 @@ func RetryIfTextFileBusy(fn func() error) error {
 	}
 }
 
+// RunCmd runs cmd and kills the whole process group created by Setpgid when ctx is done,
+// exec.CommandContext would only kill the process itself and leave its children running.
+// started is called after the process is started if not nil, the process is killed if it fails.
+func RunCmd(ctx context.Context, cmd *exec.Cmd, started func() error) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-finished:
+		}
+	}()
+	if started != nil {
+		if err := started(); err != nil {
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			_ = cmd.Wait()
+			return err
+		}
+	}
+	return cmd.Wait()
+}
+
 // Run a command, retrying "text file busy" errors.
-func Run(ctx context.Context, command *repb.Command, workDir string, stdin io.Reader, stdout io.Writer) *interfaces.CommandResult {
+// Outputs of the command are also written to stdout and stderr if they are not nil.
+func Run(ctx context.Context, command *repb.Command, workDir string, stdin io.Reader, stdout, stderr io.Writer) *interfaces.CommandResult {
 	var cmd *exec.Cmd
 	var stdoutBuf, stderrBuf *bytes.Buffer
 
 	err := RetryIfTextFileBusy(func() error {
 		// Create a new command on each attempt since commands can only be run once.
-		cmd, stdoutBuf, stderrBuf = constructExecCommand(ctx, command, workDir, stdin, stdout)
-		return cmd.Run()
+		cmd, stdoutBuf, stderrBuf = ConstructExecCommand(ctx, command, workDir, stdin, stdout, stderr)
+		return RunCmd(ctx, cmd, nil)
 	})
 
 	exitCode, err := ExitCode(ctx, cmd, err)
@@ -91,6 +124,26 @@ func Run(ctx context.Context, command *repb.Command, workDir string, stdin io.Re
 		Stdout:             stdoutBuf.Bytes(),
 		Stderr:             stderrBuf.Bytes(),
 		CommandDebugString: cmd.String(),
+		UsageStats:         UsageStats(cmd),
+	}
+}
+
+// UsageStats returns resources used by the exited cmd and its descendants waited for, nil if cmd was not started
+func UsageStats(cmd *exec.Cmd) *usagepb.UsageStats {
+	if cmd.ProcessState == nil {
+		return nil
+	}
+	rusage, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return nil
+	}
+	return &usagepb.UsageStats{
+		UserCpuTime:   durationpb.New(time.Duration(rusage.Utime.Nano())),
+		SystemCpuTime: durationpb.New(time.Duration(rusage.Stime.Nano())),
+		// ru_maxrss is in kilobytes, ru_inblock and ru_oublock are in 512-byte blocks
+		PeakMemoryBytes: rusage.Maxrss * 1024,
+		ReadBytes:       rusage.Inblock * 512,
+		WriteBytes:      rusage.Oublock * 512,
 	}
 }
 
@@ -144,6 +197,9 @@ func ExitCode(ctx context.Context, cmd *exec.Cmd, err error) (int, error) {
 		if dl, ok := ctx.Deadline(); ok && time.Now().After(dl) {
 			return exitCode, status.DeadlineExceededErrorf("Command timed out: %s", err.Error())
 		}
+		if ctx.Err() == context.Canceled {
+			return exitCode, status.CanceledErrorf("Command canceled: %s", err.Error())
+		}
 		// If the command didn't time out, it was probably killed by the kernel due to OOM.
 		return exitCode, status.ResourceExhaustedErrorf("Command `%s` was killed: %s", cmd.String(), err.Error())
 	}
@@ -42,7 +42,7 @@ func (h *HealthChecker) Start() {
 	receive := make(chan error)
 	for interval := range h.checkers {
 		for idx := range h.checkers[interval] {
-			go func(fn CheckFunc) {
+			go func(fn CheckFunc, interval time.Duration) {
 				logrus.Infof("register checker %s for every %d", getFunctionName(fn), interval)
 				tk := time.NewTicker(interval)
 				for range tk.C {
@@ -51,7 +51,7 @@ func (h *HealthChecker) Start() {
 						receive <- err
 					}
 				}
-			}(h.checkers[interval][idx])
+			}(h.checkers[interval][idx], interval)
 		}
 	}
 
@@ -0,0 +1,127 @@
+// Package platform matches platform properties of actions against the properties declared by executors.
+package platform
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+
+	"github.com/dashjay/baize/pkg/config"
+)
+
+const (
+	// OSFamily and ISA are defined by the platform lexicon of remote execution api,
+	// executors report the values of current host if they are not configured.
+	OSFamily = "OSFamily"
+	ISA      = "ISA"
+
+	// ContainerImage is the image the action should be run in
+	ContainerImage = "container-image"
+	// DockerNetwork is "standard" if the action needs network, actions run in containers have no network by default
+	DockerNetwork = "dockerNetwork"
+	// Pool partitions executors, actions without Pool are only run by executors without Pool
+	Pool = "Pool"
+
+	// CPU and Memory are CPU slots and bytes of memory requested by the action, they are
+	// checked against free resources of executors instead of declared properties.
+	CPU    = "cpu"
+	Memory = "mem"
+
+	// Any is a value declared by executors accepting any value of the property
+	Any = "*"
+)
+
+// hostISA maps GOARCH to the ISA names of the platform lexicon
+var hostISA = map[string]string{
+	"386":   "x86-32",
+	"amd64": "x86-64",
+	"arm64": "aarch64",
+}
+
+func hostOSFamily() string {
+	if runtime.GOOS == "darwin" {
+		return "macos"
+	}
+	return runtime.GOOS
+}
+
+// New returns the platform of an executor with properties declared in config,
+// OSFamily and ISA of the host are filled if not declared. Executors with a container runtime accept
+// any container-image, and executors isolating actions by a container runtime or sandbox accept any dockerNetwork.
+func New(cfg *config.ExecutorConfig) *repb.Platform {
+	properties := make(map[string]string, len(cfg.Platform)+4)
+	for name, value := range cfg.Platform {
+		properties[name] = value
+	}
+	declare := func(name, value string) {
+		if _, exists := properties[name]; !exists {
+			properties[name] = value
+		}
+	}
+	declare(OSFamily, hostOSFamily())
+	isa, known := hostISA[runtime.GOARCH]
+	if !known {
+		isa = runtime.GOARCH
+	}
+	declare(ISA, isa)
+	if cfg.ContainerRuntime != "" {
+		declare(ContainerImage, Any)
+	}
+	if cfg.ContainerRuntime != "" || (cfg.Sandbox != nil && cfg.Sandbox.Enabled) {
+		declare(DockerNetwork, Any)
+	}
+	p := &repb.Platform{}
+	for name, value := range properties {
+		p.Properties = append(p.Properties, &repb.Platform_Property{Name: name, Value: value})
+	}
+	sort.Slice(p.Properties, func(i, j int) bool {
+		return p.Properties[i].GetName() < p.Properties[j].GetName()
+	})
+	return p
+}
+
+// Get returns value of the property with name, empty if not present
+func Get(p *repb.Platform, name string) string {
+	for _, property := range p.GetProperties() {
+		if property.GetName() == name {
+			return property.GetValue()
+		}
+	}
+	return ""
+}
+
+// Satisfies returns nil if an executor of platform executor can run actions requiring platform required.
+// Every property required must be declared by the executor with the same value or Any, except CPU and Memory.
+// Values of OSFamily and ISA are compared case-insensitively, e.g. OSFamily=Linux is satisfied by linux.
+func Satisfies(executor, required *repb.Platform) error {
+	if Get(executor, Pool) != Get(required, Pool) {
+		return fmt.Errorf("%s %q is required but executor is in %q", Pool, Get(required, Pool), Get(executor, Pool))
+	}
+	for _, property := range required.GetProperties() {
+		name := property.GetName()
+		if name == CPU || name == Memory {
+			continue
+		}
+		declared := Get(executor, name)
+		if declared == Any || declared == property.GetValue() {
+			continue
+		}
+		if (name == OSFamily || name == ISA) && strings.EqualFold(declared, property.GetValue()) {
+			continue
+		}
+		return fmt.Errorf("%s %q is required but executor has %q", name, property.GetValue(), declared)
+	}
+	return nil
+}
+
+// String formats the platform as name=value pairs
+func String(p *repb.Platform) string {
+	pairs := make([]string, 0, len(p.GetProperties()))
+	for _, property := range p.GetProperties() {
+		pairs = append(pairs, property.GetName()+"="+property.GetValue())
+	}
+	return strings.Join(pairs, ",")
+}
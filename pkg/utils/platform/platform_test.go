@@ -0,0 +1,57 @@
+package platform
+
+import (
+	"testing"
+
+	repb "github.com/bazelbuild/remote-apis/build/bazel/remote/execution/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dashjay/baize/pkg/config"
+)
+
+func newPlatform(kvs ...string) *repb.Platform {
+	p := &repb.Platform{}
+	for i := 0; i < len(kvs); i += 2 {
+		p.Properties = append(p.Properties, &repb.Platform_Property{Name: kvs[i], Value: kvs[i+1]})
+	}
+	return p
+}
+
+func TestNew(t *testing.T) {
+	p := New(&config.ExecutorConfig{Platform: map[string]string{ISA: "aarch64", "gpu": "true"}})
+	assert.Equal(t, "aarch64", Get(p, ISA))
+	assert.NotEmpty(t, Get(p, OSFamily))
+	assert.Equal(t, "true", Get(p, "gpu"))
+	assert.Equal(t, "", Get(p, Pool))
+	assert.Equal(t, "", Get(p, ContainerImage))
+	assert.Equal(t, "", Get(p, DockerNetwork))
+
+	// executors running actions in containers or sandboxes accept any image and network
+	p = New(&config.ExecutorConfig{ContainerRuntime: "docker", Platform: map[string]string{DockerNetwork: "off"}})
+	assert.Equal(t, Any, Get(p, ContainerImage))
+	assert.Equal(t, "off", Get(p, DockerNetwork))
+	p = New(&config.ExecutorConfig{Sandbox: &config.SandboxConfig{Enabled: true}})
+	assert.Equal(t, "", Get(p, ContainerImage))
+	assert.Equal(t, Any, Get(p, DockerNetwork))
+	assert.Nil(t, Satisfies(p, newPlatform(DockerNetwork, "standard")))
+}
+
+func TestSatisfies(t *testing.T) {
+	executor := newPlatform(OSFamily, "linux", ISA, "x86-64", ContainerImage, Any, "gpu", "true")
+	assert.Nil(t, Satisfies(executor, nil))
+	assert.Nil(t, Satisfies(executor, newPlatform(OSFamily, "linux", ISA, "x86-64")))
+	assert.Nil(t, Satisfies(executor, newPlatform(ContainerImage, "docker://ubuntu:20.04", "gpu", "true")))
+	assert.NotNil(t, Satisfies(executor, newPlatform(ISA, "aarch64")))
+	// OSFamily and ISA are case-insensitive, other properties are not
+	assert.Nil(t, Satisfies(executor, newPlatform(OSFamily, "Linux", ISA, "X86-64")))
+	assert.NotNil(t, Satisfies(executor, newPlatform("gpu", "TRUE")))
+	assert.NotNil(t, Satisfies(executor, newPlatform("tpu", "true")))
+	// resource requests are not declared by executors
+	assert.Nil(t, Satisfies(executor, newPlatform(OSFamily, "linux", CPU, "4", Memory, "2G")))
+
+	// executors in a pool only run actions requiring the pool
+	pooled := newPlatform(OSFamily, "linux", Pool, "arm")
+	assert.NotNil(t, Satisfies(pooled, newPlatform(OSFamily, "linux")))
+	assert.Nil(t, Satisfies(pooled, newPlatform(Pool, "arm")))
+	assert.NotNil(t, Satisfies(executor, newPlatform(Pool, "arm")))
+}